@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocatedSize returns the bytes allocated for the file on disk.
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	// st_blocks is always counted in 512-byte units.
+	return int64(st.Blocks) * 512, true
+}
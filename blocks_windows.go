@@ -0,0 +1,10 @@
+package fs
+
+import (
+	"os"
+)
+
+// allocatedSize is not available from file info on windows.
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	return 0, false
+}
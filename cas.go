@@ -0,0 +1,336 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// blobsDir is the hidden dir under work dir to store blobs in cas mode.
+//
+// Content with sha256 `abcdef...` will be stored as `.blobs/ab/cd/abcdef...`, and
+// objects are hard links to their blobs, so the link count of a blob is the count
+// of its references plus one. The file system under work dir must support hard links.
+const (
+	blobsDir    = ".blobs"
+	blobsTmpDir = "tmp"
+
+	// blobXattr is the extended attribute to store the blob hash.
+	blobXattr = "blob"
+
+	// blobTmpRetention is the duration temporary files will be kept before collected.
+	blobTmpRetention = 24 * time.Hour
+)
+
+// GCBlobs will remove blobs which are not referenced by any object.
+//
+// Blobs are released while objects are deleted or overwritten, but blobs referenced by
+// trash entries and versions will only be collected by GCBlobs after they have been purged.
+func (s *Storage) GCBlobs() (n int, err error) {
+	ctx := context.Background()
+	return s.GCBlobsWithContext(ctx)
+}
+
+// GCBlobsWithContext will remove blobs which are not referenced by any object.
+//
+// Blobs are released while objects are deleted or overwritten, but blobs referenced by
+// trash entries and versions will only be collected by GCBlobsWithContext after they have been purged.
+func (s *Storage) GCBlobsWithContext(ctx context.Context) (n int, err error) {
+	defer func() {
+		err = s.formatError("gc_blobs", err)
+	}()
+
+	if !s.cas {
+		return 0, services.ErrCapabilityInsufficient
+	}
+	return s.gcBlobs(ctx)
+}
+
+func (s *Storage) gcBlobs(ctx context.Context) (n int, err error) {
+	root := filepath.Join(s.workDir, blobsDir)
+	tmpDir := filepath.Join(root, blobsTmpDir)
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+		// Temporary files could be used by pending writes.
+		if filepath.Dir(path) == tmpDir {
+			if time.Since(info.ModTime()) > blobTmpRetention {
+				return os.Remove(path)
+			}
+			return nil
+		}
+
+		ok, err := removeBlobIfOrphan(path)
+		if ok {
+			n++
+		}
+		return err
+	})
+	return n, err
+}
+
+// writeBlob writes the content into a blob and links the object to it.
+func (s *Storage) writeBlob(rp string, r io.Reader, size int64, opt pairStorageWrite) (n int64, err error) {
+	err = s.checkWriteTarget(rp)
+	if err != nil {
+		return
+	}
+
+	tmpDir := filepath.Join(s.workDir, blobsDir, blobsTmpDir)
+	err = os.MkdirAll(tmpDir, 0755)
+	if err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(tmpDir, "")
+	if err != nil {
+		return
+	}
+	tmp := f.Name()
+	// The temporary file is only used to create the blob.
+	defer os.Remove(tmp)
+
+	hr := sha256.New()
+	n, h, err := s.writeFile(f, tmp, io.TeeReader(r, hr), size, opt)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	// Archive the current content only after the new content has been written.
+	err = s.archiveVersion(rp)
+	if err != nil {
+		return n, err
+	}
+
+	sum := hex.EncodeToString(hr.Sum(nil))
+	err = setXattr(tmp, blobXattr, []byte(sum))
+	if err != nil {
+		return n, err
+	}
+
+	bp := s.getBlobPath(sum)
+	err = os.MkdirAll(filepath.Dir(bp), 0755)
+	if err != nil {
+		return n, err
+	}
+
+	created := false
+	for {
+		err = os.Link(tmp, bp)
+		if err == nil {
+			created = true
+		} else if !errors.Is(err, os.ErrExist) {
+			return n, err
+		}
+
+		err = s.linkBlob(bp, rp)
+		// The existing blob could be collected before we link to it, try again.
+		if errors.Is(err, os.ErrNotExist) && !created {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		break
+	}
+
+	if h == nil {
+		return n, nil
+	}
+	if created {
+		return n, s.saveChecksum(rp, h)
+	}
+	// Content of the existing blob could differ from ours while encrypted.
+	if _, ok, err := s.loadChecksum(rp); err != nil || ok {
+		return n, err
+	}
+	checksum, err := computeChecksum(context.Background(), rp, s.checksumAlgorithm)
+	if err != nil {
+		return n, err
+	}
+	return n, s.saveChecksumString(rp, checksum)
+}
+
+// copyBlob links dst to the blob of src, returns false if src is not stored as a blob.
+func (s *Storage) copyBlob(rs, rd string) (ok bool, err error) {
+	sum, ok, err := getBlobSum(rs)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = s.checkWriteTarget(rd)
+	if err != nil {
+		return false, err
+	}
+
+	// The current content is kept, because the blob will be linked by rename.
+	_, err = s.linkVersion(rd)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.linkBlob(s.getBlobPath(sum), rd)
+	if err != nil {
+		return false, err
+	}
+
+	if s.checksumAlgorithm == "" {
+		return true, nil
+	}
+	// Checksum in extended attribute is shared by the blob, only sidecar needs to be copied.
+	checksum, ok, err := s.loadChecksum(rs)
+	if err != nil || !ok {
+		return true, err
+	}
+	return true, s.saveChecksumString(rd, checksum)
+}
+
+// checkWriteTarget makes sure the object could be replaced by rename, which is
+// used while linking to a blob or publishing a temporary file.
+func (s *Storage) checkWriteTarget(rp string) (err error) {
+	fi, err := os.Lstat(rp)
+	if err == nil {
+		if fi.IsDir() || fi.Mode()&os.ModeSymlink != 0 {
+			return services.ErrObjectModeInvalid
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.MkdirAll(filepath.Dir(rp), 0755)
+}
+
+// linkBlob replaces the object with a hard link to the blob atomically.
+func (s *Storage) linkBlob(bp, rp string) (err error) {
+	lp := filepath.Join(s.workDir, blobsDir, blobsTmpDir, filepath.Base(bp)+"."+formatTimeID(time.Now()))
+
+	err = os.Link(bp, lp)
+	if err != nil {
+		return err
+	}
+
+	// The previous content should be released after replaced.
+	sum, ok, err := getBlobSum(rp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = os.Remove(lp)
+		return err
+	}
+
+	err = os.Rename(lp, rp)
+	if err != nil {
+		_ = os.Remove(lp)
+		return err
+	}
+
+	if ok {
+		return s.releaseBlob(sum)
+	}
+	return nil
+}
+
+// unlinkBlob removes the object if it's linked to a blob, so that the blob will not be
+// modified in place.
+func (s *Storage) unlinkBlob(rp string) (err error) {
+	sum, ok, err := getBlobSum(rp)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	err = os.Remove(rp)
+	if err != nil {
+		return err
+	}
+	return s.releaseBlob(sum)
+}
+
+// releaseBlob removes the blob if it's not referenced anymore.
+func (s *Storage) releaseBlob(sum string) (err error) {
+	_, err = removeBlobIfOrphan(s.getBlobPath(sum))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func removeBlobIfOrphan(bp string) (ok bool, err error) {
+	n, err := linkCount(bp)
+	if err != nil {
+		return false, err
+	}
+	if n > 1 {
+		return false, nil
+	}
+
+	err = os.Remove(bp)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkCasSupported makes sure extended attributes are supported under the dir.
+//
+// Objects are linked to blobs by the blob hash in extended attribute, without which
+// shared blobs could be modified in place, so cas must be refused.
+func checkCasSupported(dir string) (err error) {
+	err = setXattr(dir, blobXattr, nil)
+	if errors.Is(err, errXattrUnsupported) {
+		return fmt.Errorf("%w: cas requires extended attributes", services.ErrCapabilityInsufficient)
+	}
+	if err != nil {
+		return err
+	}
+	return removeXattr(dir, blobXattr)
+}
+
+// getBlobSum returns the hash of the blob which this file links to.
+//
+// Extended attributes are always supported while cas is enabled, see checkCasSupported.
+func getBlobSum(rp string) (sum string, ok bool, err error) {
+	v, err := getXattr(rp, blobXattr)
+	if err != nil {
+		if errors.Is(err, errXattrNotExist) || errors.Is(err, errXattrUnsupported) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	// Ignore values which are not set by us.
+	if _, err = hex.DecodeString(string(v)); err != nil || len(v) != 2*sha256.Size {
+		return "", false, nil
+	}
+	return string(v), true, nil
+}
+
+func (s *Storage) getBlobPath(sum string) string {
+	return filepath.Join(s.workDir, blobsDir, sum[:2], sum[2:4], sum)
+}
@@ -0,0 +1,169 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func newCASStorager(t *testing.T, pairs ...Pair) *Storage {
+	s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir()), WithCas()}, pairs...)...)
+	if errors.Is(err, services.ErrCapabilityInsufficient) {
+		t.Skip("xattr is not supported")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCASXattrUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	_, err := newStorager(ps.WithWorkDir(dir), WithCas())
+
+	// Objects linked to blobs could not be recognized without xattr, cas must be refused.
+	if xerr := setXattr(dir, "test", []byte("test")); errors.Is(xerr, errXattrUnsupported) {
+		assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient))
+		return
+	}
+	assert.NoError(t, err)
+	// The probe should not be left on work dir.
+	_, err = getXattr(dir, blobXattr)
+	assert.True(t, errors.Is(err, errXattrNotExist))
+}
+
+func getTestBlobPath(s *Storage, content []byte) string {
+	sum := sha256.Sum256(content)
+	return s.getBlobPath(hex.EncodeToString(sum[:]))
+}
+
+func TestCAS(t *testing.T) {
+	s := newCASStorager(t)
+
+	content := []byte("hello, cas!")
+	for _, path := range []string{"a", "b/c"} {
+		_, err := s.Write(path, bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+	}
+
+	bp := getTestBlobPath(s, content)
+	n, err := linkCount(bp)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+
+	var buf bytes.Buffer
+	_, err = s.Read("b/c", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// Copy shares the blob too.
+	err = s.Copy("a", "d")
+	assert.NoError(t, err)
+	n, err = linkCount(bp)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), n)
+
+	// Blobs should not be listed.
+	it, err := s.List("")
+	assert.NoError(t, err)
+	for {
+		o, err := it.Next()
+		if errors.Is(err, IterateDone) {
+			break
+		}
+		assert.NoError(t, err)
+		assert.NotEqual(t, blobsDir, o.Path)
+	}
+
+	// Overwrite releases the reference.
+	other := []byte("another content")
+	_, err = s.Write("d", bytes.NewReader(other), int64(len(other)))
+	assert.NoError(t, err)
+	n, err = linkCount(bp)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+
+	for _, path := range []string{"a", "b/c"} {
+		err = s.Delete(path)
+		assert.NoError(t, err)
+	}
+	_, err = os.Stat(bp)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+
+	// Blob of d is still referenced.
+	_, err = os.Stat(getTestBlobPath(s, other))
+	assert.NoError(t, err)
+}
+
+func TestCASAppend(t *testing.T) {
+	s := newCASStorager(t)
+
+	content := []byte("hello, cas!")
+	_, err := s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	_, err = s.Write("b", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	o, err := s.Stat("a")
+	assert.NoError(t, err)
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.True(t, errors.Is(err, services.ErrObjectModeInvalid), "%v", err)
+
+	// Create append will not truncate the shared blob.
+	o, err = s.CreateAppend("a")
+	assert.NoError(t, err)
+	_, err = s.WriteAppend(o, bytes.NewReader([]byte("x")), 1)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = s.Read("b", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestCASGC(t *testing.T) {
+	s := newCASStorager(t, WithVersioning())
+
+	content := []byte("hello, cas!")
+	_, err := s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// The version still references the blob.
+	err = s.Delete("a")
+	assert.NoError(t, err)
+	bp := getTestBlobPath(s, content)
+	_, err = os.Stat(bp)
+	assert.NoError(t, err)
+
+	n, err := s.GCBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	err = os.RemoveAll(s.getAbsPath(versionsDir))
+	assert.NoError(t, err)
+
+	n, err = s.GCBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(bp)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+}
+
+func TestCASDisabled(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.GCBlobs()
+	assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient), "%v", err)
+}
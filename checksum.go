@@ -0,0 +1,332 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// Available checksum algorithms.
+//
+// Checksums are computed over the bytes stored on disk, which are compressed or
+// encrypted if enabled, so they verify the stored file instead of the content
+// returned by Read.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+)
+
+const (
+	// checksumXattr is the extended attribute to store checksum.
+	checksumXattr = "checksum"
+	// checksumsDir is the hidden dir under work dir to store checksum sidecars,
+	// it's only used while extended attributes are not supported.
+	//
+	// Checksum of object `a/b` will be stored in `.checksums/a/b`.
+	checksumsDir = ".checksums"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable), nil
+	default:
+		return nil, fmt.Errorf("checksum algorithm %s is not supported", algorithm)
+	}
+}
+
+// formatChecksum formats the checksum as `<algorithm>:<hex>`.
+func formatChecksum(algorithm string, h hash.Hash) string {
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+func parseChecksum(checksum string) (algorithm string, ok bool) {
+	idx := strings.IndexByte(checksum, ':')
+	if idx <= 0 {
+		return "", false
+	}
+	return checksum[:idx], true
+}
+
+// newChecksumWriter returns a writer which computes checksum while writing into w.
+//
+// The returned hash will be nil if checksum is not enabled.
+func (s *Storage) newChecksumWriter(w io.Writer) (io.Writer, hash.Hash) {
+	if s.checksumAlgorithm == "" {
+		return w, nil
+	}
+	// The algorithm has been checked in newStorager.
+	h, _ := newChecksumHash(s.checksumAlgorithm)
+	return io.MultiWriter(w, h), h
+}
+
+// saveChecksum stores the checksum in extended attribute, and fallback to sidecar file.
+func (s *Storage) saveChecksum(rp string, h hash.Hash) (err error) {
+	return s.saveChecksumString(rp, formatChecksum(s.checksumAlgorithm, h))
+}
+
+func (s *Storage) saveChecksumString(rp, checksum string) (err error) {
+	err = setXattr(rp, checksumXattr, []byte(checksum))
+	if err == nil || !errors.Is(err, errXattrUnsupported) {
+		return err
+	}
+
+	sp, ok := s.getChecksumSidecarPath(rp)
+	if !ok {
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(sp), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sp, []byte(checksum), 0644)
+}
+
+// loadChecksum returns the stored checksum, returns false if not stored.
+func (s *Storage) loadChecksum(rp string) (checksum string, ok bool, err error) {
+	v, err := getXattr(rp, checksumXattr)
+	if err == nil {
+		return string(v), true, nil
+	}
+	if !errors.Is(err, errXattrNotExist) && !errors.Is(err, errXattrUnsupported) {
+		return "", false, err
+	}
+
+	sp, ok := s.getChecksumSidecarPath(rp)
+	if !ok {
+		return "", false, nil
+	}
+	v, err = ioutil.ReadFile(sp)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return string(v), true, nil
+}
+
+// removeChecksum removes the stored checksum, it's used while the content has been changed
+// without a new checksum.
+func (s *Storage) removeChecksum(rp string) (err error) {
+	// Checksum in extended attribute has been removed along with the file.
+	err = removeXattr(rp, checksumXattr)
+	if err != nil && !errors.Is(err, errXattrUnsupported) && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if sp, ok := s.getChecksumSidecarPath(rp); ok {
+		err = os.Remove(sp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveChecksum moves the sidecar checksum along with the file.
+//
+// Checksum stored in extended attribute will be moved with the inode, nothing to do.
+func (s *Storage) moveChecksum(rs, rd string) (err error) {
+	ss, ok := s.getChecksumSidecarPath(rs)
+	if !ok {
+		return nil
+	}
+	if _, err = os.Lstat(ss); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	sd, ok := s.getChecksumSidecarPath(rd)
+	if !ok {
+		return os.Remove(ss)
+	}
+	err = os.MkdirAll(filepath.Dir(sd), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(ss, sd)
+}
+
+func (s *Storage) getChecksumSidecarPath(rp string) (string, bool) {
+	rel, ok := s.getWorkDirRel(rp)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(s.workDir, checksumsDir, rel), true
+}
+
+// computeChecksum reads the whole file and computes its checksum.
+func computeChecksum(ctx context.Context, rp, algorithm string) (checksum string, err error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(rp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Check the context between chunks, so that scrubbing large files could be cancelled.
+	buf := make([]byte, 1024*1024)
+	for {
+		if err = ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.Read(buf)
+		_, _ = h.Write(buf[:n])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return formatChecksum(algorithm, h), nil
+}
+
+// ScrubResult is a file which doesn't match its stored checksum.
+type ScrubResult struct {
+	// Path is slash separated and relative to the work dir.
+	Path string
+	// Expected is the stored checksum.
+	Expected string
+	// Actual is the checksum computed from current content.
+	Actual string
+}
+
+// ScrubIterator walks a dir and verifies every file against its stored checksum.
+type ScrubIterator struct {
+	s   *Storage
+	ctx context.Context
+
+	// dirs to be walked.
+	dirs []string
+	// files to be verified in current dir.
+	files []string
+}
+
+// Next returns the next mismatched file, IterateDone will be returned while all files have been verified.
+//
+// Files without stored checksum will be skipped. Next can be called again after an error returned,
+// the failed file will be skipped.
+func (it *ScrubIterator) Next() (r ScrubResult, err error) {
+	for {
+		if err = it.ctx.Err(); err != nil {
+			return
+		}
+
+		if len(it.files) == 0 {
+			if len(it.dirs) == 0 {
+				return r, IterateDone
+			}
+
+			dir := it.dirs[len(it.dirs)-1]
+			it.dirs = it.dirs[:len(it.dirs)-1]
+
+			fis, err := readDirInfos(dir)
+			if err != nil {
+				return r, it.s.formatError("scrub", err, it.s.relPath(dir))
+			}
+			for _, fi := range fis {
+				fp := filepath.Join(dir, fi.Name())
+				if it.s.isHiddenPath(fp) {
+					continue
+				}
+				if fi.IsDir() {
+					it.dirs = append(it.dirs, fp)
+				} else if fi.Mode().IsRegular() {
+					it.files = append(it.files, fp)
+				}
+			}
+			continue
+		}
+
+		fp := it.files[0]
+		it.files = it.files[1:]
+
+		expected, ok, err := it.s.loadChecksum(fp)
+		if err != nil {
+			return r, it.s.formatError("scrub", err, it.s.relPath(fp))
+		}
+		if !ok {
+			continue
+		}
+		algorithm, ok := parseChecksum(expected)
+		if !ok {
+			return ScrubResult{Path: it.s.relPath(fp), Expected: expected}, nil
+		}
+
+		actual, err := computeChecksum(it.ctx, fp, algorithm)
+		if err != nil {
+			return r, it.s.formatError("scrub", err, it.s.relPath(fp))
+		}
+		if actual != expected {
+			return ScrubResult{
+				Path:     it.s.relPath(fp),
+				Expected: expected,
+				Actual:   actual,
+			}, nil
+		}
+	}
+}
+
+// Scrub will verify all files under the path against their stored checksums,
+// and returns mismatched files via iterator.
+func (s *Storage) Scrub(path string) (it *ScrubIterator, err error) {
+	ctx := context.Background()
+	return s.ScrubWithContext(ctx, path)
+}
+
+// ScrubWithContext will verify all files under the path against their stored checksums,
+// and returns mismatched files via iterator.
+func (s *Storage) ScrubWithContext(ctx context.Context, path string) (it *ScrubIterator, err error) {
+	defer func() {
+		err = s.formatError("scrub", err, path)
+	}()
+
+	// Dirs are never sharded, so try the dir first.
+	rp := s.getAbsDirPath(path)
+	fi, err := os.Stat(rp)
+	if err != nil || !fi.IsDir() {
+		rp = s.getAbsPath(path)
+		if err = checkStdPath(rp); err != nil {
+			return nil, err
+		}
+		fi, err = os.Stat(rp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	it = &ScrubIterator{s: s, ctx: ctx}
+	switch {
+	case fi.IsDir():
+		it.dirs = []string{rp}
+	case fi.Mode().IsRegular():
+		it.files = []string{rp}
+	default:
+		return nil, services.ErrObjectModeInvalid
+	}
+	return it, nil
+}
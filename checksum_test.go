@@ -0,0 +1,124 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestChecksum(t *testing.T) {
+	cases := []struct {
+		name      string
+		algorithm string
+		expected  string
+	}{
+		{"sha256", ChecksumSHA256, "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"crc32c", ChecksumCRC32C, "crc32c:c99465aa"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(tt.algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content := []byte("hello world")
+			_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+			assert.NoError(t, err)
+
+			o, err := s.Stat("a")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, GetObjectSystemMetadata(o).Checksum)
+
+			err = s.Copy("a", "b")
+			assert.NoError(t, err)
+			o, err = s.Stat("b")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, GetObjectSystemMetadata(o).Checksum)
+		})
+	}
+}
+
+func TestChecksumCancel(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write("a", bytes.NewReader([]byte("a")), 1)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = computeChecksum(ctx, s.getAbsPath("a"), ChecksumSHA256)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+}
+
+func TestChecksumInvalidAlgorithm(t *testing.T) {
+	_, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm("md4"))
+	assert.Error(t, err)
+}
+
+func TestChecksumAppend(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("a")
+	assert.NoError(t, err)
+	for _, v := range []string{"hello", " ", "world"} {
+		_, err = s.WriteAppend(o, bytes.NewReader([]byte(v)), int64(len(v)))
+		assert.NoError(t, err)
+	}
+	err = s.CommitAppend(o)
+	assert.NoError(t, err)
+
+	o, err = s.Stat("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		GetObjectSystemMetadata(o).Checksum)
+}
+
+func TestScrub(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumCRC32C))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello world")
+	for _, p := range []string{"a", "dir/b", "dir/sub/c"} {
+		_, err = s.Write(p, bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+	}
+
+	// Simulate bit rot behind the storager's back.
+	err = ioutil.WriteFile(s.getAbsPath("dir/sub/c"), []byte("hello w0rld"), 0644)
+	assert.NoError(t, err)
+
+	it, err := s.Scrub("")
+	assert.NoError(t, err)
+
+	var results []ScrubResult
+	for {
+		r, err := it.Next()
+		if err == types.IterateDone {
+			break
+		}
+		assert.NoError(t, err)
+		results = append(results, r)
+	}
+
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "dir/sub/c", results[0].Path)
+		assert.Equal(t, "crc32c:c99465aa", results[0].Expected)
+		assert.NotEqual(t, results[0].Expected, results[0].Actual)
+	}
+}
@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Available compression algorithms.
+const (
+	CompressionGzip = "gzip"
+)
+
+const (
+	// compressionXattr is the extended attribute to mark the file as compressed.
+	compressionXattr = "compression"
+
+	// compressionFrameSize is the logical size of every compressed frame.
+	compressionFrameSize = 1024 * 1024
+	// compressionMagic is at the end of every compressed file.
+	compressionMagic = "FSGZIDX1"
+	// compressionTrailerSize is the size of trailer: logical size, frame size, frame count and magic.
+	compressionTrailerSize = 8 * 4
+)
+
+// errNotCompressed means the file is not compressed by us.
+var errNotCompressed = errors.New("not compressed")
+
+func checkCompression(algorithm string) error {
+	switch algorithm {
+	case CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("compression algorithm %s is not supported", algorithm)
+	}
+}
+
+// compressedIndex is the index of a seekable compressed file.
+//
+// The compressed file is formatted as:
+//
+//	[frame 0]...[frame n-1][frame 0 length]...[frame n-1 length][logical size][frame size][n][magic]
+//
+// Every frame is an independent gzip member which contains frame size bytes except
+// the last one, so we can start decompressing from any frame. All integers are
+// stored as big endian uint64.
+type compressedIndex struct {
+	algorithm string
+	// size is the logical size of the content.
+	size int64
+	// frameSize is the logical size of every frame.
+	frameSize int64
+	// offsets is the physical offsets of every frame, the last one is the end of all frames.
+	offsets []int64
+}
+
+// writeCompressed reads size bytes from r and writes the compressed frames and index into w.
+//
+// All content until EOF will be read if size is -1.
+func writeCompressed(w io.Writer, r io.Reader, size int64) (n int64, err error) {
+	cw := &countWriter{w: w}
+	zw := gzip.NewWriter(cw)
+
+	var lengths []int64
+	buf := make([]byte, compressionFrameSize)
+	for eof := false; !eof && (size < 0 || n < size); {
+		m := int64(len(buf))
+		if size >= 0 && size-n < m {
+			m = size - n
+		}
+
+		read, err := io.ReadFull(r, buf[:m])
+		n += int64(read)
+		if err != nil {
+			if size >= 0 || !(errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				// Keep the same behavior with io.CopyN.
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					err = io.EOF
+				}
+				return n, err
+			}
+			// All content has been read, compress the last frame.
+			eof = true
+			m = int64(read)
+			if m == 0 {
+				break
+			}
+		}
+
+		start := cw.n
+		zw.Reset(cw)
+		_, err = zw.Write(buf[:m])
+		if err != nil {
+			return n, err
+		}
+		err = zw.Close()
+		if err != nil {
+			return n, err
+		}
+		lengths = append(lengths, cw.n-start)
+	}
+
+	index := make([]byte, 8*len(lengths)+compressionTrailerSize)
+	for i, v := range lengths {
+		binary.BigEndian.PutUint64(index[8*i:], uint64(v))
+	}
+	trailer := index[8*len(lengths):]
+	binary.BigEndian.PutUint64(trailer[0:], uint64(n))
+	binary.BigEndian.PutUint64(trailer[8:], compressionFrameSize)
+	binary.BigEndian.PutUint64(trailer[16:], uint64(len(lengths)))
+	copy(trailer[24:], compressionMagic)
+
+	_, err = cw.Write(index)
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// readCompressedIndex reads the index from the end of the file.
+func readCompressedIndex(r io.ReaderAt, physicalSize int64) (idx *compressedIndex, err error) {
+	if physicalSize < compressionTrailerSize {
+		return nil, errNotCompressed
+	}
+
+	trailer := make([]byte, compressionTrailerSize)
+	_, err = r.ReadAt(trailer, physicalSize-compressionTrailerSize)
+	if err != nil {
+		return nil, err
+	}
+	if string(trailer[24:]) != compressionMagic {
+		return nil, errNotCompressed
+	}
+
+	size := int64(binary.BigEndian.Uint64(trailer[0:]))
+	frameSize := int64(binary.BigEndian.Uint64(trailer[8:]))
+	count := int64(binary.BigEndian.Uint64(trailer[16:]))
+
+	if count < 0 || frameSize <= 0 || size < 0 || count > (physicalSize-compressionTrailerSize)/8 {
+		return nil, errNotCompressed
+	}
+	indexSize := 8 * count
+
+	index := make([]byte, indexSize)
+	_, err = r.ReadAt(index, physicalSize-compressionTrailerSize-indexSize)
+	if err != nil {
+		return nil, err
+	}
+
+	idx = &compressedIndex{
+		algorithm: CompressionGzip,
+		size:      size,
+		frameSize: frameSize,
+		offsets:   make([]int64, count+1),
+	}
+	for i := int64(0); i < count; i++ {
+		idx.offsets[i+1] = idx.offsets[i] + int64(binary.BigEndian.Uint64(index[8*i:]))
+	}
+	// All frames and the index should take the whole file.
+	if idx.offsets[count] != physicalSize-compressionTrailerSize-indexSize {
+		return nil, errNotCompressed
+	}
+	return idx, nil
+}
+
+// isMarkedCompressed checks whether the file has been marked as compressed.
+func (s *Storage) isMarkedCompressed(rp string) (ok bool, err error) {
+	_, err = getXattr(rp, compressionXattr)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, errXattrNotExist):
+		return false, nil
+	case errors.Is(err, errXattrUnsupported):
+		// Fallback to detect by index only if compression has been enabled.
+		return s.compression != "", nil
+	default:
+		return false, err
+	}
+}
+
+// markCompressed marks the file as compressed.
+func markCompressed(rp, algorithm string) error {
+	err := setXattr(rp, compressionXattr, []byte(algorithm))
+	if errors.Is(err, errXattrUnsupported) {
+		// The file will be detected by index.
+		return nil
+	}
+	return err
+}
+
+// compressedReader decompresses the content from the offset.
+type compressedReader struct {
+	r   io.ReaderAt
+	idx *compressedIndex
+
+	frame int
+	skip  int64
+	zr    *gzip.Reader
+	cur   io.Reader
+}
+
+func newCompressedReader(r io.ReaderAt, idx *compressedIndex, offset int64) *compressedReader {
+	cr := &compressedReader{
+		r:     r,
+		idx:   idx,
+		frame: len(idx.offsets) - 1,
+	}
+	if offset < idx.size {
+		cr.frame = int(offset / idx.frameSize)
+		cr.skip = offset % idx.frameSize
+	}
+	return cr
+}
+
+func (cr *compressedReader) Read(p []byte) (n int, err error) {
+	for {
+		if cr.cur == nil {
+			if cr.frame >= len(cr.idx.offsets)-1 {
+				return 0, io.EOF
+			}
+
+			start, end := cr.idx.offsets[cr.frame], cr.idx.offsets[cr.frame+1]
+			sr := io.NewSectionReader(cr.r, start, end-start)
+			if cr.zr == nil {
+				cr.zr, err = gzip.NewReader(sr)
+			} else {
+				err = cr.zr.Reset(sr)
+			}
+			if err != nil {
+				return 0, err
+			}
+			cr.zr.Multistream(false)
+			cr.frame++
+
+			if cr.skip > 0 {
+				_, err = io.CopyN(ioutil.Discard, cr.zr, cr.skip)
+				if err != nil {
+					return 0, err
+				}
+				cr.skip = 0
+			}
+			cr.cur = cr.zr
+		}
+
+		n, err = cr.cur.Read(p)
+		if errors.Is(err, io.EOF) {
+			cr.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
@@ -0,0 +1,120 @@
+package fs
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestCompression(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the content takes several frames and is compressible.
+	content := bytes.Repeat([]byte("hello, compression!\n"), 3*compressionFrameSize/20+7)
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	o, err := s.Stat("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), o.MustGetContentLength())
+	sm := GetObjectSystemMetadata(o)
+	assert.Equal(t, CompressionGzip, sm.Compression)
+	assert.Less(t, sm.PhysicalSize, int64(len(content)))
+
+	fi, err := os.Stat(o.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, fi.Size(), sm.PhysicalSize)
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	cases := []struct {
+		name   string
+		offset int64
+		size   int64
+	}{
+		{"inside first frame", 3, 10},
+		{"cross frames", compressionFrameSize - 5, 10},
+		{"from second frame", compressionFrameSize + 1, 2 * compressionFrameSize},
+		{"beyond end", int64(len(content)) + 10, 10},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err = s.Read("a", &buf, ps.WithOffset(tt.offset), ps.WithSize(tt.size))
+			assert.NoError(t, err)
+
+			start, end := tt.offset, tt.offset+tt.size
+			if start > int64(len(content)) {
+				start = int64(len(content))
+			}
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			assert.Equal(t, content[start:end], buf.Bytes())
+		})
+	}
+
+	// Copied object should still be readable.
+	err = s.Copy("a", "b")
+	assert.NoError(t, err)
+	buf.Reset()
+	_, err = s.Read("b", &buf, ps.WithOffset(compressionFrameSize))
+	assert.NoError(t, err)
+	assert.Equal(t, content[compressionFrameSize:], buf.Bytes())
+}
+
+func TestCompressionOverwritten(t *testing.T) {
+	workDir := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(workDir), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := make([]byte, 1024)
+	rand.Read(content)
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// Overwrite by a storager without compression, the outdated mark should be ignored.
+	plain, err := newStorager(ps.WithWorkDir(workDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = plain.Write("a", bytes.NewReader(content[:100]), 100)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content[:100], buf.Bytes())
+}
+
+func TestCompressionEmpty(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("a", nil, 0)
+	assert.NoError(t, err)
+
+	o, err := s.Stat("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), o.MustGetContentLength())
+
+	var buf bytes.Buffer
+	n, err := s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
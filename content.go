@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// objectContent is the logical content of a file, which could be encrypted and compressed.
+//
+// Content is compressed before encrypted, so the compressed frames are read from
+// the decrypted content.
+type objectContent struct {
+	// r is the content under compression, and size is its size.
+	r    io.ReaderAt
+	size int64
+
+	enc *encryptedFile
+	idx *compressedIndex
+}
+
+// Size returns the logical size of the content.
+func (c *objectContent) Size() int64 {
+	if c.idx != nil {
+		return c.idx.size
+	}
+	return c.size
+}
+
+// Transformed returns whether the content differs from the file on disk.
+func (c *objectContent) Transformed() bool {
+	return c.enc != nil || c.idx != nil
+}
+
+// NewReader returns a reader of the logical content from offset.
+func (c *objectContent) NewReader(offset int64) io.Reader {
+	if c.idx != nil {
+		// Decompress from the frame which contains the offset directly.
+		return newCompressedReader(c.r, c.idx, offset)
+	}
+	if offset > c.size {
+		offset = c.size
+	}
+	return io.NewSectionReader(c.r, offset, c.size-offset)
+}
+
+// ReadAt implements io.ReaderAt on the logical content.
+//
+// Compressed content will be decompressed from the frame which contains off for every call.
+func (c *objectContent) ReadAt(p []byte, off int64) (n int, err error) {
+	if c.idx == nil {
+		return c.r.ReadAt(p, off)
+	}
+	if off >= c.idx.size {
+		return 0, io.EOF
+	}
+
+	n, err = io.ReadFull(newCompressedReader(c.r, c.idx, off), p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// openContent detects how the content of the file has been stored.
+func (s *Storage) openContent(f *os.File, rp string) (c *objectContent, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	c = &objectContent{r: f, size: fi.Size()}
+
+	ef, ok, err := s.openEncrypted(f)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		c.r, c.size, c.enc = ef, ef.size, ef
+	}
+
+	// The file should be marked as compressed and carry a valid index. The mark could be
+	// outdated after the file has been overwritten in place, and the index will tell.
+	ok, err = s.isMarkedCompressed(rp)
+	if err != nil || !ok {
+		return c, err
+	}
+	c.idx, err = readCompressedIndex(c.r, c.size)
+	if err != nil && !errors.Is(err, errNotCompressed) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// statContent opens the file to detect its content only if it could be transformed.
+//
+// The returned content can't be read anymore.
+func (s *Storage) statContent(rp string) (c *objectContent, ok bool, err error) {
+	if len(s.encryptionKeys) == 0 {
+		ok, err = s.isMarkedCompressed(rp)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	f, err := os.Open(rp)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	c, err = s.openContent(f, rp)
+	if err != nil {
+		return nil, false, err
+	}
+	return c, c.Transformed(), nil
+}
@@ -0,0 +1,143 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+const (
+	// directIOAlignment is the alignment of buffers, offsets and sizes for direct I/O,
+	// which is the logical block size of most devices.
+	directIOAlignment = 4096
+	// directIOBufferSize is the size of buffer used by direct I/O.
+	directIOBufferSize = 1024 * 1024
+)
+
+// errDirectIOUnsupported means direct I/O is refused by the platform or the file system,
+// buffered I/O should be used instead.
+var errDirectIOUnsupported = errors.New("direct io unsupported")
+
+// alignedBuffer returns a buffer whose address is aligned for direct I/O.
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directIOAlignment)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&b[0])) & (directIOAlignment - 1)); rem != 0 {
+		off = directIOAlignment - rem
+	}
+	return b[off : off+size]
+}
+
+// directWriter writes aligned chunks into a file opened with direct I/O.
+//
+// Content must be written from the start of the file, and the unaligned tail will
+// be written with direct I/O disabled while closing.
+type directWriter struct {
+	f   *os.File
+	buf []byte
+}
+
+// newDirectWriter enables direct I/O on f, returns errDirectIOUnsupported if refused.
+func newDirectWriter(f *os.File) (*directWriter, error) {
+	err := setDirectIO(f, true)
+	if err != nil {
+		return nil, err
+	}
+	return &directWriter{f: f, buf: alignedBuffer(directIOBufferSize)[:0]}, nil
+}
+
+func (w *directWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+
+		if len(w.buf) == cap(w.buf) {
+			_, err = w.f.Write(w.buf)
+			if err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Close writes the buffered tail and disables direct I/O, f will not be closed.
+func (w *directWriter) Close() (err error) {
+	// Write the aligned part with direct I/O.
+	aligned := len(w.buf) &^ (directIOAlignment - 1)
+	if aligned > 0 {
+		_, err = w.f.Write(w.buf[:aligned])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = setDirectIO(w.f, false)
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Write(w.buf[aligned:])
+	w.buf = w.buf[:0]
+	return err
+}
+
+// directReader reads a file opened with direct I/O from offset by aligned chunks.
+type directReader struct {
+	f   *os.File
+	buf []byte
+	// off is the aligned file offset of next chunk.
+	off int64
+	// skip is the count of bytes to skip in next chunk.
+	skip int
+
+	pending []byte
+	err     error
+}
+
+// newDirectReader enables direct I/O on f, returns errDirectIOUnsupported if refused.
+func newDirectReader(f *os.File, offset int64) (*directReader, error) {
+	err := setDirectIO(f, true)
+	if err != nil {
+		return nil, err
+	}
+
+	aligned := offset &^ (directIOAlignment - 1)
+	return &directReader{
+		f:    f,
+		buf:  alignedBuffer(directIOBufferSize),
+		off:  aligned,
+		skip: int(offset - aligned),
+	}, nil
+}
+
+func (r *directReader) Read(p []byte) (n int, err error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		m, err := r.f.ReadAt(r.buf, r.off)
+		r.off += int64(m)
+		if err != nil {
+			r.err = err
+		}
+		if m <= r.skip {
+			r.skip -= m
+			continue
+		}
+		r.pending = r.buf[r.skip:m]
+		r.skip = 0
+	}
+
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// directIOFallback returns true if buffered I/O should be used instead.
+func directIOFallback(err error) bool {
+	return errors.Is(err, errDirectIOUnsupported)
+}
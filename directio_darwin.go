@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDirectIO toggles F_NOCACHE on the opened file, which is the equivalent of O_DIRECT.
+func setDirectIO(f *os.File, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	_, err := unix.FcntlInt(f.Fd(), unix.F_NOCACHE, v)
+	if err != nil {
+		return &os.PathError{Op: "fcntl", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// adviseSequential is a no-op, darwin doesn't support posix_fadvise.
+func adviseSequential(f *os.File) error {
+	return nil
+}
+
+// dropPageCache is a no-op, darwin doesn't support posix_fadvise.
+func dropPageCache(f *os.File, dirty bool) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDirectIO toggles O_DIRECT on the opened file.
+func setDirectIO(f *os.File, on bool) error {
+	flags, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		return &os.PathError{Op: "fcntl", Path: f.Name(), Err: err}
+	}
+	if on {
+		flags |= unix.O_DIRECT
+	} else {
+		flags &^= unix.O_DIRECT
+	}
+
+	_, err = unix.FcntlInt(f.Fd(), unix.F_SETFL, flags)
+	if err == unix.EINVAL {
+		return errDirectIOUnsupported
+	}
+	if err != nil {
+		return &os.PathError{Op: "fcntl", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// adviseSequential hints the kernel that the file will be accessed sequentially.
+func adviseSequential(f *os.File) error {
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+// dropPageCache drops pages of the file from page cache, dirty pages will be
+// flushed first so that they could be dropped.
+func dropPageCache(f *os.File, dirty bool) error {
+	if dirty {
+		err := unix.Fdatasync(int(f.Fd()))
+		if err != nil {
+			return &os.PathError{Op: "fdatasync", Path: f.Name(), Err: err}
+		}
+	}
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,253 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// cachedRatio returns the ratio of pages of the file which are in page cache.
+func cachedRatio(tb testing.TB, path string) float64 {
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if fi.Size() == 0 {
+		return 0
+	}
+
+	data, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer unix.Munmap(data)
+
+	pageSize := os.Getpagesize()
+	vec := make([]byte, (len(data)+pageSize-1)/pageSize)
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE,
+		uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		tb.Fatal(errno)
+	}
+
+	cached := 0
+	for _, v := range vec {
+		if v&1 != 0 {
+			cached++
+		}
+	}
+	return float64(cached) / float64(len(vec))
+}
+
+func TestDirectIO(t *testing.T) {
+	cases := []struct {
+		name   string
+		size   int
+		offset int64
+	}{
+		{"empty", 0, 0},
+		{"small", 100, 10},
+		{"aligned", 2 * directIOAlignment, directIOAlignment},
+		{"large", 3*directIOBufferSize + 123, directIOBufferSize + 1},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := make([]byte, tt.size)
+			rand.Read(content)
+
+			_, err = s.Write("a", bytes.NewReader(content), int64(tt.size), WithDirectIo())
+			assert.NoError(t, err)
+
+			var buf bytes.Buffer
+			_, err = s.Read("a", &buf, WithDirectIo())
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(content, buf.Bytes()))
+
+			if tt.offset > int64(tt.size) {
+				return
+			}
+			buf.Reset()
+			_, err = s.Read("a", &buf, WithDirectIo(), ps.WithOffset(tt.offset), ps.WithSize(int64(tt.size)/2))
+			assert.NoError(t, err)
+			end := tt.offset + int64(tt.size)/2
+			if end > int64(tt.size) {
+				end = int64(tt.size)
+			}
+			assert.True(t, bytes.Equal(content[tt.offset:end], buf.Bytes()))
+		})
+	}
+}
+
+func TestDirectIOTransformed(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithEncryptionKey(testKeyA), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("hello world"), 100000)
+
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)), WithDirectIo(), WithSequentialIo())
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf, WithDirectIo(), WithSequentialIo())
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, buf.Bytes()))
+}
+
+// skipWithoutPageCache skips the test if the dir is on a file system which doesn't
+// drop pages as advised, like memory backed file systems and overlay.
+func skipWithoutPageCache(t *testing.T, dir string) {
+	var st unix.Statfs_t
+	err := unix.Statfs(dir, &st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch uint32(st.Type) {
+	case unix.TMPFS_MAGIC, unix.RAMFS_MAGIC, unix.OVERLAYFS_SUPER_MAGIC:
+		t.Skipf("page cache is not controllable on file system %#x", st.Type)
+	}
+}
+
+func TestIOModesPageCache(t *testing.T) {
+	dir := t.TempDir()
+	skipWithoutPageCache(t, dir)
+
+	s, err := newStorager(ps.WithWorkDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, 8*directIOBufferSize)
+	rand.Read(content)
+
+	_, err = s.Write("buffered", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	_, err = s.Write("sequential", bytes.NewReader(content), int64(len(content)), WithSequentialIo())
+	assert.NoError(t, err)
+
+	buffered := cachedRatio(t, s.getAbsPath("buffered"))
+	sequential := cachedRatio(t, s.getAbsPath("sequential"))
+	assert.Less(t, sequential, buffered)
+
+	// Pages read with sequential hint should be dropped after read.
+	_, err = s.Read("sequential", &bytes.Buffer{}, WithSequentialIo())
+	assert.NoError(t, err)
+	assert.Less(t, cachedRatio(t, s.getAbsPath("sequential")), 0.5)
+}
+
+// BenchmarkWriteIOModes shows the throughput and the ratio of pages left in page cache after written.
+func BenchmarkWriteIOModes(b *testing.B) {
+	modes := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"buffered", nil},
+		{"direct", []Pair{WithDirectIo()}},
+		{"sequential", []Pair{WithSequentialIo()}},
+		{"direct+sequential", []Pair{WithDirectIo(), WithSequentialIo()}},
+	}
+
+	content := make([]byte, 64*1024*1024)
+	rand.Read(content)
+
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			s, err := newStorager(ps.WithWorkDir(b.TempDir()))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var cached float64
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				path := fmt.Sprintf("%d", i)
+				_, err = s.Write(path, bytes.NewReader(content), int64(len(content)), m.pairs...)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				cached += cachedRatio(b, s.getAbsPath(path))
+				_ = os.Remove(s.getAbsPath(path))
+				b.StartTimer()
+			}
+			b.ReportMetric(100*cached/float64(b.N), "cached-%")
+		})
+	}
+}
+
+// BenchmarkReadIOModes shows the throughput and the ratio of pages left in page cache after read.
+func BenchmarkReadIOModes(b *testing.B) {
+	modes := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"buffered", nil},
+		{"direct", []Pair{WithDirectIo()}},
+		{"sequential", []Pair{WithSequentialIo()}},
+	}
+
+	content := make([]byte, 64*1024*1024)
+	rand.Read(content)
+
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			s, err := newStorager(ps.WithWorkDir(b.TempDir()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			// Drop pages of the written content, so that all reads start with a cold cache.
+			_, err = s.Write("a", bytes.NewReader(content), int64(len(content)), WithSequentialIo())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var cached float64
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = s.Read("a", &discardWriter{}, m.pairs...)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				cached += cachedRatio(b, s.getAbsPath("a"))
+				f, err := os.Open(s.getAbsPath("a"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = dropPageCache(f, false)
+				_ = f.Close()
+				b.StartTimer()
+			}
+			b.ReportMetric(100*cached/float64(b.N), "cached-%")
+		})
+	}
+}
+
+// discardWriter is the same as ioutil.Discard without implementing io.ReaderFrom,
+// so that content will be read by the storager itself.
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fs
+
+import (
+	"os"
+)
+
+// setDirectIO is not supported on this platform.
+func setDirectIO(f *os.File, on bool) error {
+	if on {
+		return errDirectIOUnsupported
+	}
+	return nil
+}
+
+// adviseSequential is a no-op on this platform.
+func adviseSequential(f *os.File) error {
+	return nil
+}
+
+// dropPageCache is a no-op on this platform.
+func dropPageCache(f *os.File, dirty bool) error {
+	return nil
+}
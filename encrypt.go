@@ -0,0 +1,321 @@
+package fs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// defaultEncryptionKeyID is the key id while encryption_key_id is not set.
+	defaultEncryptionKeyID = "default"
+
+	// encryptionMagic is at the beginning of every encrypted file.
+	encryptionMagic = "FSENC001"
+	// encryptionChunkSize is the plaintext size of every encrypted chunk.
+	encryptionChunkSize = 64 * 1024
+	// encryptionMaxChunkSize is used to refuse broken headers.
+	encryptionMaxChunkSize = 64 * 1024 * 1024
+	// encryptionHeaderSize is the size of header without key id: magic, chunk size, nonce and key id length.
+	encryptionHeaderSize = 8 + 4 + 12 + 1
+	// encryptionMaxKeyIDSize is the max length of key id.
+	encryptionMaxKeyIDSize = 255
+)
+
+func (s *Storage) addEncryptionKey(id string, key []byte) error {
+	if id == "" || len(id) > encryptionMaxKeyIDSize {
+		return fmt.Errorf("encryption key id %q is invalid", id)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("encryption key %s is invalid: %v", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	if s.encryptionKeys == nil {
+		s.encryptionKeys = make(map[string]cipher.AEAD)
+	}
+	s.encryptionKeys[id] = aead
+	return nil
+}
+
+// The encrypted file is formatted as:
+//
+//	[magic][chunk size][nonce][key id length][key id][chunk 0]...[chunk n-1]
+//
+// Every chunk is sealed by AES-GCM independently with the nonce xor chunk index, and
+// authenticates its index and whether it's the last chunk, so that reordered or truncated
+// chunks will be detected. There is at least one chunk even if the content is empty.
+// All integers are stored as big endian.
+
+func chunkNonce(dst, nonce []byte, index uint64) []byte {
+	dst = append(dst[:0], nonce...)
+	for i := 0; i < 8; i++ {
+		dst[len(dst)-1-i] ^= byte(index >> (8 * i))
+	}
+	return dst
+}
+
+func chunkAdditionalData(dst []byte, index uint64, last bool) []byte {
+	dst = append(dst[:0], make([]byte, 9)...)
+	binary.BigEndian.PutUint64(dst, index)
+	if last {
+		dst[8] = 1
+	}
+	return dst
+}
+
+// encryptWriter encrypts content into chunks, Close must be called to write the last chunk.
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+
+	index uint64
+	buf   []byte
+	out   []byte
+	tmp   []byte
+	ad    []byte
+}
+
+// newEncryptWriter writes the header into w and returns a writer which encrypts with current key.
+func (s *Storage) newEncryptWriter(w io.Writer) (ew *encryptWriter, err error) {
+	aead := s.encryptionKeys[s.encryptionKeyID]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, encryptionHeaderSize+len(s.encryptionKeyID))
+	header = append(header, encryptionMagic...)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[len(encryptionMagic):], encryptionChunkSize)
+	header = append(header, nonce...)
+	header = append(header, byte(len(s.encryptionKeyID)))
+	header = append(header, s.encryptionKeyID...)
+
+	_, err = w.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// Only seal the full chunk while we know there is more content.
+		if len(ew.buf) == cap(ew.buf) {
+			err = ew.seal(false)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		m := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close writes the last chunk, the underlying writer will not be closed.
+func (ew *encryptWriter) Close() error {
+	return ew.seal(true)
+}
+
+func (ew *encryptWriter) seal(last bool) error {
+	ew.tmp = chunkNonce(ew.tmp, ew.nonce, ew.index)
+	ew.ad = chunkAdditionalData(ew.ad, ew.index, last)
+	ew.out = ew.aead.Seal(ew.out[:0], ew.tmp, ew.buf, ew.ad)
+
+	_, err := ew.w.Write(ew.out)
+	if err != nil {
+		return err
+	}
+	ew.index++
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+// encryptedFile decrypts the needed chunks only while reading.
+//
+// encryptedFile caches the last decrypted chunk, so it's not safe for concurrent use.
+type encryptedFile struct {
+	r    io.ReaderAt
+	aead cipher.AEAD
+
+	keyID     string
+	nonce     []byte
+	chunkSize int64
+	// offset is the physical offset of the first chunk.
+	offset int64
+	// chunks is the count of chunks.
+	chunks int64
+	// physicalSize is the size of file on disk.
+	physicalSize int64
+	// size is the size of plaintext.
+	size int64
+
+	cached int64
+	plain  []byte
+	buf    []byte
+	tmp    []byte
+	ad     []byte
+}
+
+// checkPlaintext refuses files which are not encrypted while encryption is enabled, so
+// that a plaintext file put into work dir will not be served as authenticated content.
+//
+// Plaintext is allowed by allow_plaintext while migrating, or if only decryption keys
+// have been configured, in which case new objects are written as plaintext.
+func (s *Storage) checkPlaintext() error {
+	if s.allowPlaintext || s.encryptionKeyID == "" {
+		return nil
+	}
+	return fmt.Errorf("%w: object is not encrypted", ErrObjectTampered)
+}
+
+// openEncrypted checks whether the file has been encrypted by us.
+//
+// Files will only be checked while any encryption key has been configured.
+func (s *Storage) openEncrypted(f *os.File) (ef *encryptedFile, ok bool, err error) {
+	if len(s.encryptionKeys) == 0 {
+		return nil, false, nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	physicalSize := fi.Size()
+	if physicalSize < encryptionHeaderSize {
+		return nil, false, s.checkPlaintext()
+	}
+
+	header := make([]byte, encryptionHeaderSize)
+	_, err = f.ReadAt(header, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	if string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, false, s.checkPlaintext()
+	}
+
+	chunkSize := int64(binary.BigEndian.Uint32(header[8:]))
+	nonce := header[12:24]
+	offset := int64(encryptionHeaderSize) + int64(header[24])
+	if offset > physicalSize {
+		return nil, false, fmt.Errorf("%w: invalid header", ErrObjectTampered)
+	}
+
+	keyID := make([]byte, header[24])
+	_, err = f.ReadAt(keyID, encryptionHeaderSize)
+	if err != nil {
+		return nil, false, err
+	}
+	aead, ok := s.encryptionKeys[string(keyID)]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, keyID)
+	}
+
+	overhead := int64(aead.Overhead())
+	if chunkSize <= 0 || chunkSize > encryptionMaxChunkSize {
+		return nil, false, fmt.Errorf("%w: invalid chunk size %d", ErrObjectTampered, chunkSize)
+	}
+
+	// All chunks are full except the last one, which contains overhead at least.
+	body := physicalSize - offset
+	chunks := (body + chunkSize + overhead - 1) / (chunkSize + overhead)
+	if chunks == 0 || body-(chunks-1)*(chunkSize+overhead) < overhead {
+		return nil, false, fmt.Errorf("%w: invalid size %d", ErrObjectTampered, physicalSize)
+	}
+
+	return &encryptedFile{
+		r:    f,
+		aead: aead,
+
+		keyID:        string(keyID),
+		nonce:        nonce,
+		chunkSize:    chunkSize,
+		offset:       offset,
+		chunks:       chunks,
+		physicalSize: physicalSize,
+		size:         body - chunks*overhead,
+
+		cached: -1,
+	}, true, nil
+}
+
+// ReadAt implements io.ReaderAt, off and n are in plaintext.
+func (ef *encryptedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	for n < len(p) && off < ef.size {
+		index := off / ef.chunkSize
+
+		plain, err := ef.chunk(index)
+		if err != nil {
+			return n, err
+		}
+
+		m := copy(p[n:], plain[off-index*ef.chunkSize:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (ef *encryptedFile) chunk(index int64) (plain []byte, err error) {
+	if index == ef.cached {
+		return ef.plain, nil
+	}
+
+	overhead := int64(ef.aead.Overhead())
+	start := ef.offset + index*(ef.chunkSize+overhead)
+	end := start + ef.chunkSize + overhead
+	if end > ef.physicalSize {
+		end = ef.physicalSize
+	}
+
+	if int64(cap(ef.buf)) < end-start {
+		ef.buf = make([]byte, end-start)
+	}
+	ef.buf = ef.buf[:end-start]
+	_, err = ef.r.ReadAt(ef.buf, start)
+	if err != nil {
+		return nil, err
+	}
+
+	ef.tmp = chunkNonce(ef.tmp, ef.nonce, uint64(index))
+	ef.ad = chunkAdditionalData(ef.ad, uint64(index), index == ef.chunks-1)
+	ef.plain, err = ef.aead.Open(ef.plain[:0], ef.tmp, ef.buf, ef.ad)
+	if err != nil {
+		ef.cached = -1
+		return nil, fmt.Errorf("%w: chunk %d", ErrObjectTampered, index)
+	}
+	ef.cached = index
+	return ef.plain, nil
+}
@@ -0,0 +1,277 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+var (
+	testKeyA = bytes.Repeat([]byte{'a'}, 32)
+	testKeyB = bytes.Repeat([]byte{'b'}, 32)
+)
+
+func TestEncryption(t *testing.T) {
+	cases := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 100},
+		{"exact chunk", encryptionChunkSize},
+		{"multiple chunks", 3*encryptionChunkSize + 17},
+	}
+
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithEncryptionKey(testKeyA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			content := make([]byte, tt.size)
+			rand.Read(content)
+
+			n, err := s.Write(tt.name, bytes.NewReader(content), int64(tt.size))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(tt.size), n)
+
+			o, err := s.Stat(tt.name)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(tt.size), o.MustGetContentLength())
+			sm := GetObjectSystemMetadata(o)
+			assert.Equal(t, defaultEncryptionKeyID, sm.EncryptionKeyID)
+			assert.Greater(t, sm.PhysicalSize, int64(tt.size))
+
+			var buf bytes.Buffer
+			_, err = s.Read(tt.name, &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, content, buf.Bytes())
+
+			if tt.size > 0 {
+				raw, err := ioutil.ReadFile(o.ID)
+				assert.NoError(t, err)
+				assert.False(t, bytes.Contains(raw, content))
+			}
+		})
+	}
+
+	content := make([]byte, 3*encryptionChunkSize)
+	rand.Read(content)
+	_, err = s.Write("range", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	for _, offset := range []int64{0, 10, encryptionChunkSize - 5, 2*encryptionChunkSize + 1} {
+		var buf bytes.Buffer
+		_, err = s.Read("range", &buf, ps.WithOffset(offset), ps.WithSize(encryptionChunkSize))
+		assert.NoError(t, err)
+
+		end := offset + encryptionChunkSize
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		assert.Equal(t, content[offset:end], buf.Bytes(), "offset %d", offset)
+	}
+}
+
+func TestEncryptionTampered(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithEncryptionKey(testKeyA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := make([]byte, 2*encryptionChunkSize+10)
+	rand.Read(content)
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	rp := s.getAbsPath("a")
+	raw, err := ioutil.ReadFile(rp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte in the second chunk, the last chunk takes 10 bytes and the overhead.
+	overhead := 16
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-10-overhead-100] ^= 1
+	err = ioutil.WriteFile(rp, tampered, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Untouched chunks are still readable.
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf, ps.WithSize(100))
+	assert.NoError(t, err)
+	assert.Equal(t, content[:100], buf.Bytes())
+
+	_, err = s.Read("a", ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrObjectTampered), "%v", err)
+
+	// Drop the last chunk.
+	err = ioutil.WriteFile(rp, raw[:len(raw)-10-overhead], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Read("a", ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrObjectTampered), "%v", err)
+}
+
+func TestEncryptionPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(dir), WithEncryptionKey(testKeyA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Plaintext put into work dir should not be served as authenticated content.
+	for _, content := range []string{"", "hello, world", strings.Repeat("a", 100)} {
+		err = ioutil.WriteFile(s.getAbsPath("a"), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Read("a", ioutil.Discard)
+		assert.True(t, errors.Is(err, ErrObjectTampered), "%v", err)
+		_, err = s.Stat("a")
+		assert.True(t, errors.Is(err, ErrObjectTampered), "%v", err)
+	}
+
+	// Plaintext objects could be read and encrypted by copying while migrating.
+	m, err := newStorager(ps.WithWorkDir(dir), WithEncryptionKey(testKeyA), WithAllowPlaintext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = m.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 100), buf.String())
+
+	err = m.Copy("a", "b")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	_, err = s.Read("b", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 100), buf.String())
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	workDir := t.TempDir()
+
+	sa, err := newStorager(ps.WithWorkDir(workDir), WithEncryptionKey(testKeyA), WithEncryptionKeyID("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("hello, encryption!")
+	_, err = sa.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// Copy with the same key doesn't touch the content.
+	err = sa.Copy("a", "same")
+	assert.NoError(t, err)
+	src, err := ioutil.ReadFile(sa.getAbsPath("a"))
+	assert.NoError(t, err)
+	dst, err := ioutil.ReadFile(sa.getAbsPath("same"))
+	assert.NoError(t, err)
+	assert.Equal(t, src, dst)
+
+	sb, err := newStorager(ps.WithWorkDir(workDir),
+		WithEncryptionKey(testKeyB), WithEncryptionKeyID("b"),
+		WithDecryptionKeys(map[string][]byte{"a": testKeyA}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	_, err = sb.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// Copy with another key will encrypt the content with current key.
+	err = sb.Copy("a", "b")
+	assert.NoError(t, err)
+	o, err := sb.Stat("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", GetObjectSystemMetadata(o).EncryptionKeyID)
+	buf.Reset()
+	_, err = sb.Read("b", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// Move keeps the content as is.
+	err = sb.Move("a", "moved")
+	assert.NoError(t, err)
+	o, err = sb.Stat("moved")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", GetObjectSystemMetadata(o).EncryptionKeyID)
+
+	sc, err := newStorager(ps.WithWorkDir(workDir), WithEncryptionKey(testKeyB), WithEncryptionKeyID("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sc.Read("moved", ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrEncryptionKeyNotFound), "%v", err)
+}
+
+func TestEncryptionCompressed(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()),
+		WithEncryptionKey(testKeyA), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("hello, compression and encryption!\n"), compressionFrameSize/10)
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	o, err := s.Stat("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), o.MustGetContentLength())
+	sm := GetObjectSystemMetadata(o)
+	assert.Equal(t, CompressionGzip, sm.Compression)
+	assert.Equal(t, defaultEncryptionKeyID, sm.EncryptionKeyID)
+	assert.Less(t, sm.PhysicalSize, int64(len(content)))
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf, ps.WithOffset(compressionFrameSize+3), ps.WithSize(100))
+	assert.NoError(t, err)
+	assert.Equal(t, content[compressionFrameSize+3:compressionFrameSize+103], buf.Bytes())
+}
+
+func TestEncryptionAppend(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithEncryptionKey(testKeyA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Appender is declared, but not available while encryption is enabled.
+	_, err = s.CreateAppend("a")
+	assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient), "%v", err)
+
+	// Objects created before encryption is enabled can't be appended either.
+	plain, err := newStorager(ps.WithWorkDir(s.workDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := plain.CreateAppend("b")
+	assert.NoError(t, err)
+	_, err = s.WriteAppend(o, bytes.NewReader([]byte("content")), 7)
+	assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient), "%v", err)
+	o, err = plain.Stat("b")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), o.MustGetContentLength())
+}
+
+func TestEncryptionInvalidKey(t *testing.T) {
+	_, err := newStorager(ps.WithWorkDir(t.TempDir()), WithEncryptionKey([]byte("short")))
+	assert.Error(t, err)
+}
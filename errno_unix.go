@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"syscall"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// errnoErrors maps errno returned by syscalls into typed errors.
+//
+// A slice is used instead of map because some errno share the same value on some platforms.
+var errnoErrors = []struct {
+	errno syscall.Errno
+	err   error
+}{
+	{syscall.ENOENT, services.ErrObjectNotExist},
+	{syscall.EACCES, services.ErrPermissionDenied},
+	{syscall.EPERM, services.ErrPermissionDenied},
+	{syscall.EISDIR, services.ErrObjectModeInvalid},
+	{syscall.ENOTDIR, services.ErrObjectModeInvalid},
+	{syscall.ENOTSUP, services.ErrCapabilityInsufficient},
+	{syscall.EOPNOTSUPP, services.ErrCapabilityInsufficient},
+	{syscall.EIO, services.ErrServiceInternal},
+	{syscall.EEXIST, ErrObjectExist},
+	{syscall.ENOSPC, ErrInsufficientStorage},
+	{syscall.EDQUOT, ErrInsufficientStorage},
+	{syscall.EROFS, ErrReadOnlyFileSystem},
+	{syscall.ENOTEMPTY, ErrDirNotEmpty},
+	{syscall.ENAMETOOLONG, ErrNameTooLong},
+	{syscall.ELOOP, ErrSymlinkLoop},
+	{syscall.EXDEV, ErrCrossDevice},
+	{syscall.EMLINK, ErrTooManyLinks},
+	{syscall.EMFILE, ErrTooManyOpenFiles},
+	{syscall.ENFILE, ErrTooManyOpenFiles},
+	{syscall.EBUSY, ErrObjectBusy},
+	{syscall.EFBIG, ErrObjectTooLarge},
+}
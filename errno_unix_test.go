@@ -0,0 +1,118 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// TestFormatErrnoProvoked provokes errors on real file systems and checks the mapped errors.
+func TestFormatErrnoProvoked(t *testing.T) {
+	tmp := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(tmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string) error {
+		_, err := s.Write(path, bytes.NewReader([]byte("hello")), 5)
+		return err
+	}
+	if err := write("file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("dir/child"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		fn       func(t *testing.T) error
+		expected error
+	}{
+		{"not exist", func(t *testing.T) error {
+			_, err := s.Read("not-exist", &bytes.Buffer{})
+			return err
+		}, services.ErrObjectNotExist},
+		{"not dir", func(t *testing.T) error {
+			return write("file/child")
+		}, services.ErrObjectModeInvalid},
+		{"name too long", func(t *testing.T) error {
+			return write(strings.Repeat("a", 1024))
+		}, ErrNameTooLong},
+		{"symlink loop", func(t *testing.T) error {
+			if err := os.Symlink("loop-b", filepath.Join(tmp, "loop-a")); err != nil {
+				return err
+			}
+			if err := os.Symlink("loop-a", filepath.Join(tmp, "loop-b")); err != nil {
+				return err
+			}
+			_, err := s.Read("loop-a", &bytes.Buffer{})
+			return err
+		}, ErrSymlinkLoop},
+		{"dir not empty", func(t *testing.T) error {
+			return s.Delete("dir")
+		}, ErrDirNotEmpty},
+		{"exist", func(t *testing.T) error {
+			return s.formatError("test", os.Mkdir(filepath.Join(tmp, "dir"), 0755))
+		}, ErrObjectExist},
+		{"too large", func(t *testing.T) error {
+			err := s.Truncate("file", 1<<62)
+			if err == nil {
+				t.Skip("file system supports huge files")
+			}
+			return err
+		}, ErrObjectTooLarge},
+		{"no space", func(t *testing.T) error {
+			f, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+			if err != nil {
+				t.Skip("/dev/full is not available")
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("hello"))
+			return s.formatError("test", err)
+		}, ErrInsufficientStorage},
+		{"permission denied", func(t *testing.T) error {
+			if os.Geteuid() == 0 {
+				t.Skip("permission is not checked for root")
+			}
+			if err := os.Chmod(filepath.Join(tmp, "file"), 0); err != nil {
+				return err
+			}
+			defer os.Chmod(filepath.Join(tmp, "file"), 0644)
+			_, err := s.Read("file", &bytes.Buffer{})
+			return err
+		}, services.ErrPermissionDenied},
+		{"cross device", func(t *testing.T) error {
+			other, err := ioutil.TempDir("/dev/shm", "")
+			if err != nil {
+				t.Skip("/dev/shm is not available")
+			}
+			defer os.RemoveAll(other)
+			err = os.Link(filepath.Join(tmp, "file"), filepath.Join(other, "file"))
+			if !errors.Is(err, syscall.EXDEV) {
+				t.Skip("/dev/shm is on the same device")
+			}
+			return s.formatError("test", err)
+		}, ErrCrossDevice},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn(t)
+			assert.True(t, errors.Is(err, tt.expected), "got %v", err)
+		})
+	}
+}
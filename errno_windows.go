@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"syscall"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	"golang.org/x/sys/windows"
+)
+
+// errnoErrors maps errors returned by windows API into typed errors.
+var errnoErrors = []struct {
+	errno syscall.Errno
+	err   error
+}{
+	{windows.ERROR_FILE_NOT_FOUND, services.ErrObjectNotExist},
+	{windows.ERROR_PATH_NOT_FOUND, services.ErrObjectNotExist},
+	{windows.ERROR_ACCESS_DENIED, services.ErrPermissionDenied},
+	{windows.ERROR_DIRECTORY, services.ErrObjectModeInvalid},
+	{windows.ERROR_NOT_SUPPORTED, services.ErrCapabilityInsufficient},
+	{windows.ERROR_ALREADY_EXISTS, ErrObjectExist},
+	{windows.ERROR_FILE_EXISTS, ErrObjectExist},
+	{windows.ERROR_DISK_FULL, ErrInsufficientStorage},
+	{windows.ERROR_HANDLE_DISK_FULL, ErrInsufficientStorage},
+	{windows.ERROR_WRITE_PROTECT, ErrReadOnlyFileSystem},
+	{windows.ERROR_DIR_NOT_EMPTY, ErrDirNotEmpty},
+	{windows.ERROR_FILENAME_EXCED_RANGE, ErrNameTooLong},
+	{windows.ERROR_CANT_RESOLVE_FILENAME, ErrSymlinkLoop},
+	{syscall.ELOOP, ErrSymlinkLoop},
+	{windows.ERROR_NOT_SAME_DEVICE, ErrCrossDevice},
+	{windows.ERROR_TOO_MANY_LINKS, ErrTooManyLinks},
+	{windows.ERROR_TOO_MANY_OPEN_FILES, ErrTooManyOpenFiles},
+	{windows.ERROR_SHARING_VIOLATION, ErrObjectBusy},
+	{windows.ERROR_LOCK_VIOLATION, ErrObjectBusy},
+	{windows.ERROR_FILE_TOO_LARGE, ErrObjectTooLarge},
+}
@@ -0,0 +1,44 @@
+package fs
+
+import (
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+var (
+	// ErrAppendOffsetMismatch means the object's append offset doesn't match the file size on disk.
+	ErrAppendOffsetMismatch = services.NewErrorCode("append offset mismatch")
+	// ErrObjectSealed means the append object has been sealed and can't be appended anymore.
+	ErrObjectSealed = services.NewErrorCode("object sealed")
+	// ErrObjectExist means the object to be created has already existed.
+	ErrObjectExist = services.NewErrorCode("object exist")
+	// ErrLockNotAcquired means the lock is held by others and can't be acquired in time.
+	ErrLockNotAcquired = services.NewErrorCode("lock not acquired")
+	// ErrObjectTampered means the encrypted content of the object failed authentication.
+	ErrObjectTampered = services.NewErrorCode("object tampered")
+	// ErrEncryptionKeyNotFound means the object has been encrypted with a key we don't have.
+	ErrEncryptionKeyNotFound = services.NewErrorCode("encryption key not found")
+	// ErrRangeInvalid means the ranges to read are negative, overlapped or beyond the end of the object.
+	ErrRangeInvalid = services.NewErrorCode("range invalid")
+	// ErrInsufficientStorage means there is no enough space or quota left on the device.
+	ErrInsufficientStorage = services.NewErrorCode("insufficient storage")
+	// ErrReadOnlyFileSystem means the file system is mounted read only.
+	ErrReadOnlyFileSystem = services.NewErrorCode("read only file system")
+	// ErrDirNotEmpty means the dir to be removed or replaced still has entries.
+	ErrDirNotEmpty = services.NewErrorCode("dir not empty")
+	// ErrNameTooLong means the path or a component of it is too long.
+	ErrNameTooLong = services.NewErrorCode("name too long")
+	// ErrSymlinkLoop means too many symlinks have been encountered while resolving the path.
+	ErrSymlinkLoop = services.NewErrorCode("symlink loop")
+	// ErrCrossDevice means the operation can't be done across different devices.
+	ErrCrossDevice = services.NewErrorCode("cross device")
+	// ErrTooManyLinks means the file has reached the max count of hard links.
+	ErrTooManyLinks = services.NewErrorCode("too many links")
+	// ErrTooManyOpenFiles means the process or system has reached the limit of open files.
+	ErrTooManyOpenFiles = services.NewErrorCode("too many open files")
+	// ErrObjectBusy means the object is in use and can't be modified now.
+	ErrObjectBusy = services.NewErrorCode("object busy")
+	// ErrSpecialFile means the object is a FIFO, socket or device node which has no content to read.
+	ErrSpecialFile = services.NewErrorCode("special file")
+	// ErrObjectTooLarge means the object exceeds the max file size of the file system.
+	ErrObjectTooLarge = services.NewErrorCode("object too large")
+)
@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"io"
+	"os"
+)
+
+// preallocateBlockSize is the step to allocate blocks by writing.
+const preallocateBlockSize = 4096
+
+// preallocateByWrite allocates blocks by writing a zero byte into every block like
+// posix_fallocate does, the size of file will be extended to size.
+//
+// It must only be used on newly created files, because existing content will be overwritten.
+func preallocateByWrite(f *os.File, size int64) (err error) {
+	defer func() {
+		if err != nil {
+			_ = f.Truncate(0)
+		}
+	}()
+
+	zero := []byte{0}
+	for off := int64(0); off < size; off += preallocateBlockSize {
+		_, err = f.WriteAt(zero, off)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = f.WriteAt(zero, size-1)
+	return err
+}
+
+// releasePreallocated releases the space which is preallocated but not written.
+func releasePreallocated(f *os.File) (err error) {
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(off)
+}
@@ -0,0 +1,31 @@
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes for the newly created file.
+//
+// FALLOC_FL_KEEP_SIZE is used so that the reserved space could be released by
+// releasePreallocated if the content is smaller than expected.
+func preallocate(f *os.File, size int64) error {
+	for {
+		err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+		if err == unix.EINTR {
+			continue
+		}
+		// Fallback to allocate by writing while the file system doesn't support fallocate.
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return preallocateByWrite(f, size)
+		}
+		if err != nil {
+			// Blocks could have been partially allocated, release them.
+			_ = f.Truncate(0)
+			return &os.PathError{Op: "fallocate", Path: f.Name(), Err: err}
+		}
+		return nil
+	}
+}
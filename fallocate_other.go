@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"os"
+)
+
+// preallocate reserves size bytes for the newly created file by writing.
+func preallocate(f *os.File, size int64) error {
+	return preallocateByWrite(f, size)
+}
@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestWritePreallocate(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"plain", nil},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}},
+		{"encrypted", []Pair{WithEncryptionKey(testKeyA)}},
+		{"cas", []Pair{WithCas()}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir())}, tt.pairs...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Compressible content, so that the preallocated space is more than written.
+			content := bytes.Repeat([]byte("0123456789"), 100000)
+			rand.Read(content[:100])
+
+			n, err := s.Write("a", bytes.NewReader(content), int64(len(content)), WithPreallocate())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), n)
+
+			var buf bytes.Buffer
+			_, err = s.Read("a", &buf)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(content, buf.Bytes()))
+
+			fi, err := os.Stat(s.getAbsPath("a"))
+			assert.NoError(t, err)
+			o, err := s.Stat("a")
+			assert.NoError(t, err)
+			assert.Equal(t, fi.Size(), GetObjectSystemMetadata(o).PhysicalSize)
+			if v, ok := allocatedSize(fi); ok {
+				// Space preallocated but not written should be released, extended
+				// attributes could take extra blocks.
+				assert.LessOrEqual(t, v, fi.Size()+4*preallocateBlockSize)
+			}
+		})
+	}
+}
+
+func TestPreallocateByWrite(t *testing.T) {
+	f, err := os.Create(t.TempDir() + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	assert.NoError(t, preallocateByWrite(f, 3*preallocateBlockSize+1))
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3*preallocateBlockSize+1), fi.Size())
+
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, releasePreallocated(f))
+	fi, err = f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+}
@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	typ "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// isFollowSymlinks checks whether symlinks should be followed, the pair of operation
+// takes precedence over the storager's.
+func (s *Storage) isFollowSymlinks(has, follow bool) bool {
+	if has {
+		return follow
+	}
+	return s.followSymlinks
+}
+
+// followSymlink resolves the symlink at rp, and returns the final target and its info.
+//
+// Targets outside of work dir or inside internal dirs will be refused, so that links
+// can't be used to access files not managed by this storager.
+func (s *Storage) followSymlink(rp string) (target string, fi os.FileInfo, err error) {
+	// Loops will be detected by the system with ELOOP.
+	fi, err = os.Stat(rp)
+	if err != nil {
+		return "", nil, err
+	}
+
+	target, err = evalSymlinks(rp)
+	if err != nil {
+		return "", nil, err
+	}
+	if target != s.workDir {
+		if _, ok := s.getWorkDirRel(target); !ok || s.isHiddenPath(target) {
+			return "", nil, fmt.Errorf("%w: symlink target %s is outside of work dir", services.ErrPermissionDenied, target)
+		}
+	}
+	return target, fi, nil
+}
+
+// followPath returns the final target if rp is a symlink, or rp itself.
+func (s *Storage) followPath(rp string) (string, error) {
+	fi, err := os.Lstat(rp)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return rp, err
+	}
+	target, _, err := s.followSymlink(rp)
+	return target, err
+}
+
+// followListedLink adds the mode of the target to the listed symlink.
+//
+// Listing will not be interrupted by broken links, they are kept as links only.
+func (s *Storage) followListedLink(o *typ.Object) {
+	target, fi, err := s.followSymlink(o.ID)
+	if err != nil {
+		return
+	}
+	o.SetLinkTarget(s.getLogicalPath(target))
+
+	switch {
+	case fi.IsDir():
+		o.Mode |= typ.ModeDir
+	case fi.Mode().IsRegular():
+		o.Mode |= typ.ModeRead | typ.ModeAppend | typ.ModePage
+	default:
+		if ft, ok := specialFileType(fi.Mode()); ok {
+			setObjectSystemMetadata(o, ObjectSystemMetadata{FileType: ft})
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("hello"), 1000)
+	_, err = s.Write("dir/a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	_, err = s.CreateLink("file", "dir/a", WithLinkTargetMode(LinkTargetRelative))
+	assert.NoError(t, err)
+	_, err = s.CreateLink("link", "dir", WithLinkTargetMode(LinkTargetRelative))
+	assert.NoError(t, err)
+
+	// Links are reported as is by default.
+	o, err := s.Stat("file")
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsLink())
+	assert.False(t, o.Mode.IsRead())
+
+	o, err = s.Stat("file", WithFollowSymlinks())
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsLink())
+	assert.True(t, o.Mode.IsRead())
+	assert.Equal(t, int64(len(content)), o.MustGetContentLength())
+	assert.Equal(t, CompressionGzip, GetObjectSystemMetadata(o).Compression)
+	assert.Equal(t, s.getAbsPath("dir/a"), o.MustGetLinkTarget())
+
+	o, err = s.Stat("link", WithFollowSymlinks())
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsDir())
+
+	var buf bytes.Buffer
+	_, err = s.Read("file", &buf, WithFollowSymlinks())
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	it, err := s.List("", ps.WithListMode(ListModeDir), WithFollowSymlinks())
+	assert.NoError(t, err)
+	modes := make(map[string]ObjectMode)
+	for {
+		o, err := it.Next()
+		if errors.Is(err, IterateDone) {
+			break
+		}
+		assert.NoError(t, err)
+		modes[o.Path] = o.Mode
+	}
+	assert.True(t, modes["link"].IsDir())
+	assert.True(t, modes["link"].IsLink())
+	assert.True(t, modes["file"].IsRead())
+}
+
+func TestFollowSymlinksBroken(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithFollowSymlinks())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.CreateLink("broken", "not-exist")
+	assert.NoError(t, err)
+
+	// Broken links are reported as links only, the same as listing.
+	o, err := s.Stat("broken")
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsLink())
+	assert.False(t, o.Mode.IsRead())
+	assert.Equal(t, filepath.Join(s.workDir, "not-exist"), o.MustGetLinkTarget())
+
+	it, err := s.List("", ps.WithListMode(ListModeDir))
+	assert.NoError(t, err)
+	lo, err := it.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "broken", lo.Path)
+	assert.Equal(t, o.Mode, lo.Mode)
+
+	_, err = s.Read("broken", &bytes.Buffer{})
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+}
+
+func TestFollowSymlinksRefused(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(filepath.Join(dir, "work")), WithFollowSymlinks())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "outside"), []byte("secret"), 0644)
+	assert.NoError(t, err)
+	_, err = s.CreateLink("escaped", filepath.Join("..", "outside"), WithLinkTargetMode(LinkTargetVerbatim))
+	assert.NoError(t, err)
+
+	_, err = s.Stat("escaped")
+	assert.True(t, errors.Is(err, services.ErrPermissionDenied))
+	_, err = s.Read("escaped", &bytes.Buffer{})
+	assert.True(t, errors.Is(err, services.ErrPermissionDenied))
+
+	// Pair of operation takes precedence over the storager's.
+	o, err := s.Stat("escaped", Pair{Key: "follow_symlinks", Value: false})
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsLink())
+
+	_, err = s.CreateLink("loop-a", "loop-b", WithLinkTargetMode(LinkTargetRelative))
+	assert.NoError(t, err)
+	_, err = s.CreateLink("loop-b", "loop-a", WithLinkTargetMode(LinkTargetRelative))
+	assert.NoError(t, err)
+
+	_, err = s.Stat("loop-a")
+	assert.True(t, errors.Is(err, ErrSymlinkLoop))
+	_, err = s.Stat("loop-a", Pair{Key: "follow_symlinks", Value: false})
+	assert.True(t, errors.Is(err, ErrSymlinkLoop))
+}
@@ -28,6 +28,15 @@ const Type = "fs"
 
 // ObjectSystemMetadata stores system metadata for object.
 type ObjectSystemMetadata struct {
+	AllocatedSize   int64
+	Checksum        string
+	Compression     string
+	EncryptionKeyID string
+	FileType        string
+	LinkCount       uint64
+	PhysicalSize    int64
+	RawLinkTarget   string
+	Streaming       bool
 }
 
 // GetObjectSystemMetadata will get ObjectSystemMetadata from Object.
@@ -51,6 +60,15 @@ func setObjectSystemMetadata(o *Object, sm ObjectSystemMetadata) {
 
 // StorageSystemMetadata stores system metadata for object.
 type StorageSystemMetadata struct {
+	AllocatedSize   int64
+	Checksum        string
+	Compression     string
+	EncryptionKeyID string
+	FileType        string
+	LinkCount       uint64
+	PhysicalSize    int64
+	RawLinkTarget   string
+	Streaming       bool
 }
 
 // GetStorageSystemMetadata will get StorageSystemMetadata from Storage.
@@ -72,6 +90,44 @@ func setStorageSystemMetadata(s *StorageMeta, sm StorageSystemMetadata) {
 	s.SetSystemMetadata(sm)
 }
 
+// WithAllowPlaintext will apply allow_plaintext value to Options.
+//
+// read objects which are not encrypted as plaintext while encryption_key is set, used while migrating
+// existing objects, they are refused as tampered by default
+func WithAllowPlaintext() Pair {
+	return Pair{Key: "allow_plaintext", Value: true}
+}
+
+// WithCas will apply cas value to Options.
+//
+// store objects in content-addressable blobs, objects with the same content share one blob, the
+// file system of work dir must support extended attributes
+func WithCas() Pair {
+	return Pair{Key: "cas", Value: true}
+}
+
+// WithChecksumAlgorithm will apply checksum_algorithm value to Options.
+//
+// compute and store checksum of objects with this algorithm, available values are sha256 and crc32c,
+// checksums cover the bytes stored on disk which are compressed or encrypted if enabled
+func WithChecksumAlgorithm(v string) Pair {
+	return Pair{Key: "checksum_algorithm", Value: v}
+}
+
+// WithCompression will apply compression value to Options.
+//
+// store objects compressed with this algorithm, available value is gzip
+func WithCompression(v string) Pair {
+	return Pair{Key: "compression", Value: v}
+}
+
+// WithDecryptionKeys will apply decryption_keys value to Options.
+//
+// are the previous keys indexed by key id, which are used to read objects encrypted before key rotation
+func WithDecryptionKeys(v map[string][]byte) Pair {
+	return Pair{Key: "decryption_keys", Value: v}
+}
+
 // WithDefaultStoragePairs will apply default_storage_pairs value to Options.
 //
 // set default pairs for storager actions
@@ -79,6 +135,119 @@ func WithDefaultStoragePairs(v DefaultStoragePairs) Pair {
 	return Pair{Key: "default_storage_pairs", Value: v}
 }
 
+// WithDirectIo will apply direct_io value to Options.
+//
+// bypass page cache with direct I/O, fallback to buffered I/O if not supported by the file system
+func WithDirectIo() Pair {
+	return Pair{Key: "direct_io", Value: true}
+}
+
+// WithEncryptionKey will apply encryption_key value to Options.
+//
+// encrypt objects with this AES key, the key should be 16, 24 or 32 bytes, objects can't be appended
+// while set
+func WithEncryptionKey(v []byte) Pair {
+	return Pair{Key: "encryption_key", Value: v}
+}
+
+// WithEncryptionKeyID will apply encryption_key_id value to Options.
+//
+// is the id of encryption_key which will be stored with objects, default to default
+func WithEncryptionKeyID(v string) Pair {
+	return Pair{Key: "encryption_key_id", Value: v}
+}
+
+// WithFollowSymlinks will apply follow_symlinks value to Options.
+//
+// follow symlinks to their targets inside work dir, so that links are reported with the mode of their
+// targets
+func WithFollowSymlinks() Pair {
+	return Pair{Key: "follow_symlinks", Value: true}
+}
+
+// WithHardLink will apply hard_link value to Options.
+//
+// create a hard link instead of a symlink, the target should be a file on the same device
+func WithHardLink() Pair {
+	return Pair{Key: "hard_link", Value: true}
+}
+
+// WithHiddenTempFiles will apply hidden_temp_files value to Options.
+//
+// keep temporary files of pending writes in the hidden .tmp dir under work dir instead of next to objects,
+// stale ones will be swept while starting
+func WithHiddenTempFiles() Pair {
+	return Pair{Key: "hidden_temp_files", Value: true}
+}
+
+// WithLayout will apply layout value to Options.
+//
+// is the layout of objects under work dir, available values are flat and sharded, default to flat
+func WithLayout(v string) Pair {
+	return Pair{Key: "layout", Value: v}
+}
+
+// WithLinkTargetMode will apply link_target_mode value to Options.
+//
+// is how the target of symlink is stored, available values are absolute, verbatim and relative, default
+// to absolute
+func WithLinkTargetMode(v string) Pair {
+	return Pair{Key: "link_target_mode", Value: v}
+}
+
+// WithMmapCacheCapacity will apply mmap_cache_capacity value to Options.
+//
+// is the max count of memory-mapped objects cached for reading, 0 means the cache is disabled
+func WithMmapCacheCapacity(v int) Pair {
+	return Pair{Key: "mmap_cache_capacity", Value: v}
+}
+
+// WithMmapCacheMaxSize will apply mmap_cache_max_size value to Options.
+//
+// is the max size of objects which could be cached by mmap_cache_capacity, default to 1 MiB
+func WithMmapCacheMaxSize(v int64) Pair {
+	return Pair{Key: "mmap_cache_max_size", Value: v}
+}
+
+// WithPreallocate will apply preallocate value to Options.
+//
+// reserve space for the content before writing, so that write fails fast if there is no enough space
+func WithPreallocate() Pair {
+	return Pair{Key: "preallocate", Value: true}
+}
+
+// WithSealAppend will apply seal_append value to Options.
+//
+// seal the append object while committing, later write_append will be refused, the seal is recorded
+// in extended attribute and read-only files are treated as sealed if extended attributes are not
+// supported
+func WithSealAppend() Pair {
+	return Pair{Key: "seal_append", Value: true}
+}
+
+// WithSequentialIo will apply sequential_io value to Options.
+//
+// hint that the content is transferred sequentially once, its pages will be dropped from page cache
+// after transferred
+func WithSequentialIo() Pair {
+	return Pair{Key: "sequential_io", Value: true}
+}
+
+// WithSkipSpecialFiles will apply skip_special_files value to Options.
+//
+// skip FIFOs, sockets and device nodes while listing
+func WithSkipSpecialFiles() Pair {
+	return Pair{Key: "skip_special_files", Value: true}
+}
+
+// WithSpecialPathResolver will apply special_path_resolver value to Options.
+//
+// resolves paths which refer to streams instead of files, default to StreamResolver which handles
+// std streams, - and /dev/fd/N
+func WithSpecialPathResolver(v SpecialPathResolver) Pair {
+	return Pair{Key: "special_path_resolver", Value: v}
+}
+
 // WithStorageFeatures will apply storage_features value to Options.
 //
 // set storage features
@@ -86,7 +255,35 @@ func WithStorageFeatures(v StorageFeatures) Pair {
 	return Pair{Key: "storage_features", Value: v}
 }
 
-var pairMap = map[string]string{"content_md5": "string", "content_type": "string", "context": "context.Context", "continuation_token": "string", "credential": "string", "default_content_type": "string", "default_io_callback": "func([]byte)", "default_storage_pairs": "DefaultStoragePairs", "endpoint": "string", "expire": "time.Duration", "http_client_options": "*httpclient.Options", "interceptor": "Interceptor", "io_callback": "func([]byte)", "list_mode": "ListMode", "location": "string", "multipart_id": "string", "name": "string", "object_mode": "ObjectMode", "offset": "int64", "size": "int64", "storage_features": "StorageFeatures", "work_dir": "string"}
+// WithTrash will apply trash value to Options.
+//
+// move deleted objects into trash instead of removing them
+func WithTrash() Pair {
+	return Pair{Key: "trash", Value: true}
+}
+
+// WithVersioning will apply versioning value to Options.
+//
+// keep previous versions of objects while overwriting or deleting
+func WithVersioning() Pair {
+	return Pair{Key: "versioning", Value: true}
+}
+
+// WithWatchInterval will apply watch_interval value to Options.
+//
+// set the interval for polling based watcher
+func WithWatchInterval(v time.Duration) Pair {
+	return Pair{Key: "watch_interval", Value: v}
+}
+
+// WithWatchRecursive will apply watch_recursive value to Options.
+//
+// watch all sub directories recursively
+func WithWatchRecursive() Pair {
+	return Pair{Key: "watch_recursive", Value: true}
+}
+
+var pairMap = map[string]string{"allow_plaintext": "bool", "cas": "bool", "checksum_algorithm": "string", "compression": "string", "content_md5": "string", "content_type": "string", "context": "context.Context", "continuation_token": "string", "credential": "string", "decryption_keys": "map[string][]byte", "default_content_type": "string", "default_io_callback": "func([]byte)", "default_storage_pairs": "DefaultStoragePairs", "direct_io": "bool", "encryption_key": "[]byte", "encryption_key_id": "string", "endpoint": "string", "expire": "time.Duration", "follow_symlinks": "bool", "hard_link": "bool", "hidden_temp_files": "bool", "http_client_options": "*httpclient.Options", "interceptor": "Interceptor", "io_callback": "func([]byte)", "layout": "string", "link_target_mode": "string", "list_mode": "ListMode", "location": "string", "mmap_cache_capacity": "int", "mmap_cache_max_size": "int64", "multipart_id": "string", "name": "string", "object_mode": "ObjectMode", "offset": "int64", "preallocate": "bool", "seal_append": "bool", "sequential_io": "bool", "size": "int64", "skip_special_files": "bool", "special_path_resolver": "SpecialPathResolver", "storage_features": "StorageFeatures", "trash": "bool", "versioning": "bool", "watch_interval": "time.Duration", "watch_recursive": "bool", "work_dir": "string"}
 var (
 	_ Appender = &Storage{}
 	_ Copier   = &Storage{}
@@ -106,14 +303,44 @@ type pairStorageNew struct {
 
 	// Required pairs
 	// Optional pairs
+	HasAllowPlaintext      bool
+	AllowPlaintext         bool
+	HasCas                 bool
+	Cas                    bool
+	HasChecksumAlgorithm   bool
+	ChecksumAlgorithm      string
+	HasCompression         bool
+	Compression            string
+	HasDecryptionKeys      bool
+	DecryptionKeys         map[string][]byte
 	HasDefaultContentType  bool
 	DefaultContentType     string
 	HasDefaultIoCallback   bool
 	DefaultIoCallback      func([]byte)
 	HasDefaultStoragePairs bool
 	DefaultStoragePairs    DefaultStoragePairs
+	HasEncryptionKey       bool
+	EncryptionKey          []byte
+	HasEncryptionKeyID     bool
+	EncryptionKeyID        string
+	HasFollowSymlinks      bool
+	FollowSymlinks         bool
+	HasHiddenTempFiles     bool
+	HiddenTempFiles        bool
+	HasLayout              bool
+	Layout                 string
+	HasMmapCacheCapacity   bool
+	MmapCacheCapacity      int
+	HasMmapCacheMaxSize    bool
+	MmapCacheMaxSize       int64
+	HasSpecialPathResolver bool
+	SpecialPathResolver    SpecialPathResolver
 	HasStorageFeatures     bool
 	StorageFeatures        StorageFeatures
+	HasTrash               bool
+	Trash                  bool
+	HasVersioning          bool
+	Versioning             bool
 	HasWorkDir             bool
 	WorkDir                string
 	// Enable features
@@ -126,6 +353,36 @@ func parsePairStorageNew(opts []Pair) (pairStorageNew, error) {
 
 	for _, v := range opts {
 		switch v.Key {
+		case "allow_plaintext":
+			if result.HasAllowPlaintext {
+				continue
+			}
+			result.HasAllowPlaintext = true
+			result.AllowPlaintext = v.Value.(bool)
+		case "cas":
+			if result.HasCas {
+				continue
+			}
+			result.HasCas = true
+			result.Cas = v.Value.(bool)
+		case "checksum_algorithm":
+			if result.HasChecksumAlgorithm {
+				continue
+			}
+			result.HasChecksumAlgorithm = true
+			result.ChecksumAlgorithm = v.Value.(string)
+		case "compression":
+			if result.HasCompression {
+				continue
+			}
+			result.HasCompression = true
+			result.Compression = v.Value.(string)
+		case "decryption_keys":
+			if result.HasDecryptionKeys {
+				continue
+			}
+			result.HasDecryptionKeys = true
+			result.DecryptionKeys = v.Value.(map[string][]byte)
 		case "default_content_type":
 			if result.HasDefaultContentType {
 				continue
@@ -144,12 +401,72 @@ func parsePairStorageNew(opts []Pair) (pairStorageNew, error) {
 			}
 			result.HasDefaultStoragePairs = true
 			result.DefaultStoragePairs = v.Value.(DefaultStoragePairs)
+		case "encryption_key":
+			if result.HasEncryptionKey {
+				continue
+			}
+			result.HasEncryptionKey = true
+			result.EncryptionKey = v.Value.([]byte)
+		case "encryption_key_id":
+			if result.HasEncryptionKeyID {
+				continue
+			}
+			result.HasEncryptionKeyID = true
+			result.EncryptionKeyID = v.Value.(string)
+		case "follow_symlinks":
+			if result.HasFollowSymlinks {
+				continue
+			}
+			result.HasFollowSymlinks = true
+			result.FollowSymlinks = v.Value.(bool)
+		case "hidden_temp_files":
+			if result.HasHiddenTempFiles {
+				continue
+			}
+			result.HasHiddenTempFiles = true
+			result.HiddenTempFiles = v.Value.(bool)
+		case "layout":
+			if result.HasLayout {
+				continue
+			}
+			result.HasLayout = true
+			result.Layout = v.Value.(string)
+		case "mmap_cache_capacity":
+			if result.HasMmapCacheCapacity {
+				continue
+			}
+			result.HasMmapCacheCapacity = true
+			result.MmapCacheCapacity = v.Value.(int)
+		case "mmap_cache_max_size":
+			if result.HasMmapCacheMaxSize {
+				continue
+			}
+			result.HasMmapCacheMaxSize = true
+			result.MmapCacheMaxSize = v.Value.(int64)
+		case "special_path_resolver":
+			if result.HasSpecialPathResolver {
+				continue
+			}
+			result.HasSpecialPathResolver = true
+			result.SpecialPathResolver = v.Value.(SpecialPathResolver)
 		case "storage_features":
 			if result.HasStorageFeatures {
 				continue
 			}
 			result.HasStorageFeatures = true
 			result.StorageFeatures = v.Value.(StorageFeatures)
+		case "trash":
+			if result.HasTrash {
+				continue
+			}
+			result.HasTrash = true
+			result.Trash = v.Value.(bool)
+		case "versioning":
+			if result.HasVersioning {
+				continue
+			}
+			result.HasVersioning = true
+			result.Versioning = v.Value.(bool)
 		case "work_dir":
 			if result.HasWorkDir {
 				continue
@@ -169,6 +486,7 @@ func parsePairStorageNew(opts []Pair) (pairStorageNew, error) {
 		result.HasDefaultStoragePairs = true
 		result.DefaultStoragePairs.Read = append(result.DefaultStoragePairs.Read, WithIoCallback(result.DefaultIoCallback))
 		result.DefaultStoragePairs.Write = append(result.DefaultStoragePairs.Write, WithIoCallback(result.DefaultIoCallback))
+		result.DefaultStoragePairs.WriteAppend = append(result.DefaultStoragePairs.WriteAppend, WithIoCallback(result.DefaultIoCallback))
 	}
 
 	return result, nil
@@ -196,6 +514,8 @@ type pairStorageCommitAppend struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
+	HasSealAppend bool
+	SealAppend    bool
 }
 
 func (s *Storage) parsePairStorageCommitAppend(opts []Pair) (pairStorageCommitAppend, error) {
@@ -204,6 +524,12 @@ func (s *Storage) parsePairStorageCommitAppend(opts []Pair) (pairStorageCommitAp
 
 	for _, v := range opts {
 		switch v.Key {
+		case "seal_append":
+			if result.HasSealAppend {
+				continue
+			}
+			result.HasSealAppend = true
+			result.SealAppend = v.Value.(bool)
 		default:
 			return pairStorageCommitAppend{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -304,6 +630,10 @@ type pairStorageCreateLink struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
+	HasHardLink       bool
+	HardLink          bool
+	HasLinkTargetMode bool
+	LinkTargetMode    string
 }
 
 func (s *Storage) parsePairStorageCreateLink(opts []Pair) (pairStorageCreateLink, error) {
@@ -312,6 +642,18 @@ func (s *Storage) parsePairStorageCreateLink(opts []Pair) (pairStorageCreateLink
 
 	for _, v := range opts {
 		switch v.Key {
+		case "hard_link":
+			if result.HasHardLink {
+				continue
+			}
+			result.HasHardLink = true
+			result.HardLink = v.Value.(bool)
+		case "link_target_mode":
+			if result.HasLinkTargetMode {
+				continue
+			}
+			result.HasLinkTargetMode = true
+			result.LinkTargetMode = v.Value.(string)
 		default:
 			return pairStorageCreateLink{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -374,8 +716,12 @@ type pairStorageList struct {
 	// Optional pairs
 	HasContinuationToken bool
 	ContinuationToken    string
+	HasFollowSymlinks    bool
+	FollowSymlinks       bool
 	HasListMode          bool
 	ListMode             ListMode
+	HasSkipSpecialFiles  bool
+	SkipSpecialFiles     bool
 }
 
 func (s *Storage) parsePairStorageList(opts []Pair) (pairStorageList, error) {
@@ -390,12 +736,24 @@ func (s *Storage) parsePairStorageList(opts []Pair) (pairStorageList, error) {
 			}
 			result.HasContinuationToken = true
 			result.ContinuationToken = v.Value.(string)
+		case "follow_symlinks":
+			if result.HasFollowSymlinks {
+				continue
+			}
+			result.HasFollowSymlinks = true
+			result.FollowSymlinks = v.Value.(bool)
 		case "list_mode":
 			if result.HasListMode {
 				continue
 			}
 			result.HasListMode = true
 			result.ListMode = v.Value.(ListMode)
+		case "skip_special_files":
+			if result.HasSkipSpecialFiles {
+				continue
+			}
+			result.HasSkipSpecialFiles = true
+			result.SkipSpecialFiles = v.Value.(bool)
 		default:
 			return pairStorageList{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -448,12 +806,18 @@ type pairStorageRead struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
-	HasIoCallback bool
-	IoCallback    func([]byte)
-	HasOffset     bool
-	Offset        int64
-	HasSize       bool
-	Size          int64
+	HasDirectIo       bool
+	DirectIo          bool
+	HasFollowSymlinks bool
+	FollowSymlinks    bool
+	HasIoCallback     bool
+	IoCallback        func([]byte)
+	HasOffset         bool
+	Offset            int64
+	HasSequentialIo   bool
+	SequentialIo      bool
+	HasSize           bool
+	Size              int64
 }
 
 func (s *Storage) parsePairStorageRead(opts []Pair) (pairStorageRead, error) {
@@ -462,6 +826,18 @@ func (s *Storage) parsePairStorageRead(opts []Pair) (pairStorageRead, error) {
 
 	for _, v := range opts {
 		switch v.Key {
+		case "direct_io":
+			if result.HasDirectIo {
+				continue
+			}
+			result.HasDirectIo = true
+			result.DirectIo = v.Value.(bool)
+		case "follow_symlinks":
+			if result.HasFollowSymlinks {
+				continue
+			}
+			result.HasFollowSymlinks = true
+			result.FollowSymlinks = v.Value.(bool)
 		case "io_callback":
 			if result.HasIoCallback {
 				continue
@@ -474,6 +850,12 @@ func (s *Storage) parsePairStorageRead(opts []Pair) (pairStorageRead, error) {
 			}
 			result.HasOffset = true
 			result.Offset = v.Value.(int64)
+		case "sequential_io":
+			if result.HasSequentialIo {
+				continue
+			}
+			result.HasSequentialIo = true
+			result.SequentialIo = v.Value.(bool)
 		case "size":
 			if result.HasSize {
 				continue
@@ -492,8 +874,10 @@ type pairStorageStat struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
-	HasObjectMode bool
-	ObjectMode    ObjectMode
+	HasFollowSymlinks bool
+	FollowSymlinks    bool
+	HasObjectMode     bool
+	ObjectMode        ObjectMode
 }
 
 func (s *Storage) parsePairStorageStat(opts []Pair) (pairStorageStat, error) {
@@ -502,6 +886,12 @@ func (s *Storage) parsePairStorageStat(opts []Pair) (pairStorageStat, error) {
 
 	for _, v := range opts {
 		switch v.Key {
+		case "follow_symlinks":
+			if result.HasFollowSymlinks {
+				continue
+			}
+			result.HasFollowSymlinks = true
+			result.FollowSymlinks = v.Value.(bool)
 		case "object_mode":
 			if result.HasObjectMode {
 				continue
@@ -520,14 +910,20 @@ type pairStorageWrite struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
-	HasContentMd5  bool
-	ContentMd5     string
-	HasContentType bool
-	ContentType    string
-	HasIoCallback  bool
-	IoCallback     func([]byte)
-	HasOffset      bool
-	Offset         int64
+	HasContentMd5   bool
+	ContentMd5      string
+	HasContentType  bool
+	ContentType     string
+	HasDirectIo     bool
+	DirectIo        bool
+	HasIoCallback   bool
+	IoCallback      func([]byte)
+	HasOffset       bool
+	Offset          int64
+	HasPreallocate  bool
+	Preallocate     bool
+	HasSequentialIo bool
+	SequentialIo    bool
 }
 
 func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
@@ -548,6 +944,12 @@ func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
 			}
 			result.HasContentType = true
 			result.ContentType = v.Value.(string)
+		case "direct_io":
+			if result.HasDirectIo {
+				continue
+			}
+			result.HasDirectIo = true
+			result.DirectIo = v.Value.(bool)
 		case "io_callback":
 			if result.HasIoCallback {
 				continue
@@ -560,6 +962,18 @@ func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
 			}
 			result.HasOffset = true
 			result.Offset = v.Value.(int64)
+		case "preallocate":
+			if result.HasPreallocate {
+				continue
+			}
+			result.HasPreallocate = true
+			result.Preallocate = v.Value.(bool)
+		case "sequential_io":
+			if result.HasSequentialIo {
+				continue
+			}
+			result.HasSequentialIo = true
+			result.SequentialIo = v.Value.(bool)
 		default:
 			return pairStorageWrite{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -572,6 +986,8 @@ type pairStorageWriteAppend struct {
 	pairs []Pair
 	// Required pairs
 	// Optional pairs
+	HasIoCallback bool
+	IoCallback    func([]byte)
 }
 
 func (s *Storage) parsePairStorageWriteAppend(opts []Pair) (pairStorageWriteAppend, error) {
@@ -580,6 +996,12 @@ func (s *Storage) parsePairStorageWriteAppend(opts []Pair) (pairStorageWriteAppe
 
 	for _, v := range opts {
 		switch v.Key {
+		case "io_callback":
+			if result.HasIoCallback {
+				continue
+			}
+			result.HasIoCallback = true
+			result.IoCallback = v.Value.(func([]byte))
 		default:
 			return pairStorageWriteAppend{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -0,0 +1,226 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// Handle is an opened object which supports random access reads.
+//
+// Handle implements io.ReaderAt, io.Reader, io.Seeker and io.Closer, all reads share
+// the same file descriptor. ReadAt is served by pread directly and safe for concurrent use.
+type Handle struct {
+	s *Storage
+	o *Object
+	f *os.File
+	c *objectContent
+
+	callback func([]byte)
+
+	// mu protects offset, and content which is decrypted or decompressed
+	// because it caches state between reads.
+	mu     sync.Mutex
+	offset int64
+}
+
+// Open will open the object for random access reads.
+//
+// Only regular files could be opened, the handle must be closed after used.
+func (s *Storage) Open(path string, pairs ...Pair) (h *Handle, err error) {
+	ctx := context.Background()
+	return s.OpenWithContext(ctx, path, pairs...)
+}
+
+// OpenWithContext will open the object for random access reads.
+//
+// Only regular files could be opened, the handle must be closed after used.
+func (s *Storage) OpenWithContext(ctx context.Context, path string, pairs ...Pair) (h *Handle, err error) {
+	defer func() {
+		err = s.formatError("open", err, path)
+	}()
+
+	opt, err := s.parsePairStorageOpen(pairs)
+	if err != nil {
+		return
+	}
+	return s.open(ctx, path, opt)
+}
+
+type pairStorageOpen struct {
+	pairs []Pair
+	// Optional pairs
+	HasIoCallback bool
+	IoCallback    func([]byte)
+}
+
+func (s *Storage) parsePairStorageOpen(opts []Pair) (pairStorageOpen, error) {
+	result := pairStorageOpen{pairs: opts}
+
+	for _, v := range opts {
+		switch v.Key {
+		case "io_callback":
+			if result.HasIoCallback {
+				continue
+			}
+			result.HasIoCallback = true
+			result.IoCallback = v.Value.(func([]byte))
+		default:
+			return pairStorageOpen{}, services.PairUnsupportedError{Pair: v}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) open(ctx context.Context, path string, opt pairStorageOpen) (h *Handle, err error) {
+	rp := s.getAbsPath(path)
+	if err = checkStdPath(rp); err != nil {
+		return nil, err
+	}
+
+	// Opening a FIFO will block, so special files are refused before opened.
+	err = checkSpecialFile(rp)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(rp)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+		}
+	}()
+
+	// Check the opened file instead of the path to avoid races.
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, services.ErrObjectModeInvalid
+	}
+
+	c, err := s.openContent(f, rp)
+	if err != nil {
+		return nil, err
+	}
+
+	o := s.newObject(true)
+	o.ID = rp
+	o.Path = path
+	o.Mode |= ModeRead
+	o.SetContentLength(c.Size())
+	o.SetLastModified(fi.ModTime())
+
+	h = &Handle{s: s, o: o, f: f, c: c}
+	if opt.HasIoCallback {
+		h.callback = opt.IoCallback
+	}
+	return h, nil
+}
+
+// ReadAt implements io.ReaderAt.
+//
+// io_callback could be called concurrently while ReadAt is called concurrently.
+func (h *Handle) ReadAt(p []byte, off int64) (n int, err error) {
+	if h.c.Transformed() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+	}
+	return h.readAt(p, off)
+}
+
+func (h *Handle) readAt(p []byte, off int64) (n int, err error) {
+	defer func() {
+		if n > 0 && h.callback != nil {
+			h.callback(p[:n])
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			err = h.s.formatError("read_at", err, h.o.Path)
+		}
+	}()
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	return h.c.ReadAt(p, off)
+}
+
+// Read implements io.Reader.
+func (h *Handle) Read(p []byte) (n int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err = h.readAt(p, h.offset)
+	h.offset += int64(n)
+	// ReadAt returns io.EOF while p is not filled, which is not an error for Read.
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker, offset is relative to the logical content.
+func (h *Handle) Seek(offset int64, whence int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.offset
+	case io.SeekEnd:
+		o, err := h.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += o.MustGetContentLength()
+	default:
+		return 0, h.s.formatError("seek", errors.New("invalid whence"), h.o.Path)
+	}
+	if offset < 0 {
+		return 0, h.s.formatError("seek", errors.New("negative offset"), h.o.Path)
+	}
+
+	h.offset = offset
+	return offset, nil
+}
+
+// Stat returns the object of this handle, the content length is the size while opened
+// if the content has been encrypted or compressed.
+func (h *Handle) Stat() (o *Object, err error) {
+	fi, err := h.f.Stat()
+	if err != nil {
+		return nil, h.s.formatError("stat", err, h.o.Path)
+	}
+
+	o = h.s.newObject(true)
+	o.ID = h.o.ID
+	o.Path = h.o.Path
+	o.Mode = h.o.Mode
+	o.SetLastModified(fi.ModTime())
+	if h.c.Transformed() {
+		o.SetContentLength(h.c.Size())
+	} else {
+		o.SetContentLength(fi.Size())
+	}
+	return o, nil
+}
+
+// Close will close the file descriptor.
+func (h *Handle) Close() (err error) {
+	err = h.f.Close()
+	if err != nil {
+		return h.s.formatError("close", err, h.o.Path)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestHandle(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"plain", nil},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}},
+		{"encrypted", []Pair{WithEncryptionKey(testKeyA)}},
+	}
+
+	content := make([]byte, 3*encryptionChunkSize+100)
+	rand.Read(content)
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir())}, tt.pairs...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+			assert.NoError(t, err)
+
+			var read int64
+			h, err := s.Open("a", ps.WithIoCallback(func(b []byte) {
+				atomic.AddInt64(&read, int64(len(b)))
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			o, err := h.Stat()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), o.MustGetContentLength())
+
+			buf := make([]byte, 100)
+			n, err := h.ReadAt(buf, encryptionChunkSize-50)
+			assert.NoError(t, err)
+			assert.Equal(t, 100, n)
+			assert.Equal(t, content[encryptionChunkSize-50:encryptionChunkSize+50], buf)
+			assert.Equal(t, int64(100), atomic.LoadInt64(&read))
+
+			// ReadAt beyond end returns io.EOF.
+			n, err = h.ReadAt(buf, int64(len(content))-10)
+			assert.Equal(t, 10, n)
+			assert.True(t, errors.Is(err, io.EOF), "%v", err)
+
+			off, err := h.Seek(-200, io.SeekEnd)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content))-200, off)
+			rest, err := ioutil.ReadAll(h)
+			assert.NoError(t, err)
+			assert.Equal(t, content[len(content)-200:], rest)
+
+			// Concurrent ReadAt should be safe.
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					off := int64(i) * encryptionChunkSize / 3
+					buf := make([]byte, 1000)
+					_, err := h.ReadAt(buf, off)
+					assert.NoError(t, err)
+					assert.Equal(t, content[off:off+1000], buf)
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestHandleDir(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateDir("dir")
+	assert.NoError(t, err)
+
+	_, err = s.Open("dir")
+	assert.True(t, errors.Is(err, services.ErrObjectModeInvalid), "%v", err)
+
+	_, err = s.Open("not_exist")
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist), "%v", err)
+}
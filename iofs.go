@@ -0,0 +1,379 @@
+//go:build go1.16
+// +build go1.16
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	typ "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// FS is an adapter which exposes Storage as io/fs.FS.
+//
+// FS implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS, names are
+// validated by fs.ValidPath and resolved against the work dir. Symlinks are
+// followed like os.DirFS, except entries returned by ReadDir.
+type FS struct {
+	s   *Storage
+	ctx context.Context
+}
+
+// noFollowSymlinks overrides the follow_symlinks of Storage.
+var noFollowSymlinks = typ.Pair{Key: "follow_symlinks", Value: false}
+
+var (
+	_ iofs.FS         = &FS{}
+	_ iofs.ReadDirFS  = &FS{}
+	_ iofs.StatFS     = &FS{}
+	_ iofs.ReadFileFS = &FS{}
+)
+
+// FS returns an io/fs.FS adapter over this Storage.
+func (s *Storage) FS() *FS {
+	ctx := context.Background()
+	return s.FSWithContext(ctx)
+}
+
+// FSWithContext returns an io/fs.FS adapter over this Storage, all operations will use this context.
+func (s *Storage) FSWithContext(ctx context.Context) *FS {
+	return &FS{s: s, ctx: ctx}
+}
+
+// HTTPFileSystem returns a http.FileSystem which could be used by http.FileServer.
+func (f *FS) HTTPFileSystem() http.FileSystem {
+	return http.FS(f)
+}
+
+// Open implements fs.FS.
+//
+// Symlinks are followed like os.DirFS, so that linked dirs will be opened as dirs.
+func (f *FS) Open(name string) (iofs.File, error) {
+	o, err := f.statTarget("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fi := newFileInfo(o)
+
+	if o.Mode.IsDir() {
+		return &dirFile{fs: f, name: name, info: fi}, nil
+	}
+
+	fp, err := f.s.followPath(o.ID)
+	if err != nil {
+		return nil, toPathError("open", name, err)
+	}
+	// Opening a FIFO will block, so special files are refused before opened.
+	err = checkSpecialFile(fp)
+	if err != nil {
+		return nil, toPathError("open", name, err)
+	}
+
+	file, err := os.Open(fp)
+	if err != nil {
+		return nil, toPathError("open", name, err)
+	}
+	c, err := f.s.openContent(file, fp)
+	if err != nil {
+		_ = file.Close()
+		return nil, toPathError("open", name, err)
+	}
+	return &regularFile{name: name, info: fi, f: file, c: c}, nil
+}
+
+// ReadDir implements fs.ReadDirFS, entries are sorted by name.
+func (f *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	o, err := f.statTarget("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !o.Mode.IsDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.readDir(name)
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (iofs.FileInfo, error) {
+	o, err := f.statTarget("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(o), nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	o, err := f.statTarget("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if o.Mode.IsDir() {
+		return nil, &iofs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	var buf bytes.Buffer
+	_, err = f.s.ReadWithContext(f.ctx, getFSPath(name), &buf, WithFollowSymlinks())
+	if err != nil {
+		return nil, toPathError("read", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *FS) stat(op, name string, pairs ...typ.Pair) (o *typ.Object, err error) {
+	// Storage treats backslash as separator, which is not allowed by fs.FS.
+	if !iofs.ValidPath(name) || strings.Contains(name, `\`) {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+
+	o, err = f.s.StatWithContext(f.ctx, getFSPath(name), pairs...)
+	if err != nil {
+		return nil, toPathError(op, name, err)
+	}
+	return o, nil
+}
+
+// statTarget returns the object with symlinks followed, the target is reported
+// instead of the link like os.Stat.
+func (f *FS) statTarget(op, name string) (o *typ.Object, err error) {
+	o, err = f.stat(op, name, WithFollowSymlinks())
+	if err != nil {
+		return nil, err
+	}
+	if !o.Mode.IsLink() {
+		return o, nil
+	}
+	// Broken links are reported as links only, but there is no target.
+	if !o.Mode.IsDir() && !o.Mode.IsRead() && GetObjectSystemMetadata(o).FileType == "" {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrNotExist}
+	}
+	o.Mode &^= typ.ModeLink
+	return o, nil
+}
+
+func (f *FS) readDir(name string) (entries []iofs.DirEntry, err error) {
+	// Entries are reported as is like os.ReadDir, symlinks are not followed.
+	it, err := f.s.ListWithContext(f.ctx, getFSPath(name), noFollowSymlinks)
+	if err != nil {
+		return nil, toPathError("readdir", name, err)
+	}
+
+	for {
+		o, err := it.Next()
+		if errors.Is(err, typ.IterateDone) {
+			break
+		}
+		if err != nil {
+			return nil, toPathError("readdir", name, err)
+		}
+		entries = append(entries, &dirEntry{fs: f, o: o})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// getFSPath converts the name used by io/fs into the path used by Storage.
+func getFSPath(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// toPathError converts errors returned by Storage into errors expected by io/fs.
+func toPathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, services.ErrObjectNotExist):
+		err = iofs.ErrNotExist
+	case errors.Is(err, services.ErrPermissionDenied):
+		err = iofs.ErrPermission
+	}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    iofs.FileMode
+	modTime time.Time
+	o       *typ.Object
+}
+
+func newFileInfo(o *typ.Object) *fileInfo {
+	fi := &fileInfo{
+		name: path.Base(o.Path),
+		o:    o,
+	}
+	if o.Path == "" {
+		fi.name = "."
+	}
+
+	fi.mode = fileType(o)
+	switch {
+	case fi.mode.IsDir():
+		fi.mode |= 0755
+	case fi.mode&iofs.ModeSymlink != 0:
+		fi.mode |= 0777
+	default:
+		fi.mode |= 0644
+	}
+	fi.size, _ = o.GetContentLength()
+	fi.modTime, _ = o.GetLastModified()
+	return fi
+}
+
+// fileType returns the type bits of the object, special files are not regular.
+func fileType(o *typ.Object) iofs.FileMode {
+	switch {
+	case o.Mode.IsDir():
+		return iofs.ModeDir
+	case o.Mode.IsLink():
+		return iofs.ModeSymlink
+	}
+
+	switch GetObjectSystemMetadata(o).FileType {
+	case FileTypeFIFO:
+		return iofs.ModeNamedPipe
+	case FileTypeSocket:
+		return iofs.ModeSocket
+	case FileTypeCharDevice:
+		return iofs.ModeDevice | iofs.ModeCharDevice
+	case FileTypeBlockDevice:
+		return iofs.ModeDevice
+	default:
+		return 0
+	}
+}
+
+func (fi *fileInfo) Name() string        { return fi.name }
+func (fi *fileInfo) Size() int64         { return fi.size }
+func (fi *fileInfo) Mode() iofs.FileMode { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time  { return fi.modTime }
+func (fi *fileInfo) IsDir() bool         { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}    { return fi.o }
+
+type dirEntry struct {
+	fs *FS
+	o  *typ.Object
+}
+
+func (e *dirEntry) Name() string { return path.Base(e.o.Path) }
+func (e *dirEntry) IsDir() bool  { return e.o.Mode.IsDir() }
+
+func (e *dirEntry) Type() iofs.FileMode {
+	return fileType(e.o)
+}
+
+// Info returns the file info by stat, because objects returned by list are not complete.
+func (e *dirEntry) Info() (iofs.FileInfo, error) {
+	o, err := e.fs.s.StatWithContext(e.fs.ctx, e.o.Path, noFollowSymlinks)
+	if err != nil {
+		return nil, toPathError("stat", e.o.Path, err)
+	}
+	return newFileInfo(o), nil
+}
+
+type dirFile struct {
+	fs   *FS
+	name string
+	info *fileInfo
+
+	entries []iofs.DirEntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error                 { return nil }
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dirFile) ReadDir(n int) (entries []iofs.DirEntry, err error) {
+	if !d.read {
+		d.entries, err = d.fs.readDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries, d.entries = d.entries, nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries, d.entries = d.entries[:n], d.entries[n:]
+	return entries, nil
+}
+
+type regularFile struct {
+	name string
+	info *fileInfo
+
+	f *os.File
+	c *objectContent
+
+	offset int64
+	r      io.Reader
+}
+
+func (rf *regularFile) Stat() (iofs.FileInfo, error) { return rf.info, nil }
+
+func (rf *regularFile) Read(p []byte) (n int, err error) {
+	if rf.r == nil {
+		rf.r = rf.c.NewReader(rf.offset)
+	}
+	n, err = rf.r.Read(p)
+	rf.offset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = toPathError("read", rf.name, err)
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker, which is required by http.FileServer.
+func (rf *regularFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rf.offset
+	case io.SeekEnd:
+		offset += rf.c.Size()
+	default:
+		return 0, &iofs.PathError{Op: "seek", Path: rf.name, Err: iofs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &iofs.PathError{Op: "seek", Path: rf.name, Err: iofs.ErrInvalid}
+	}
+
+	if offset != rf.offset {
+		rf.offset = offset
+		rf.r = nil
+	}
+	return offset, nil
+}
+
+func (rf *regularFile) Close() error {
+	return rf.f.Close()
+}
@@ -0,0 +1,179 @@
+//go:build go1.16
+// +build go1.16
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	iofs "io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func newTestFSStorager(t *testing.T, pairs ...Pair) *Storage {
+	s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir())}, pairs...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, content := range map[string]string{
+		"a":         "hello",
+		"dir/b":     "hello, world",
+		"dir/sub/c": "",
+	} {
+		_, err = s.Write(path, bytes.NewReader([]byte(content)), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = s.CreateDir("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFS(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"flat", nil},
+		{"sharded", []Pair{WithLayout(LayoutSharded)}},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}},
+		{"encrypted", []Pair{WithEncryptionKey(testKeyA)}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestFSStorager(t, tt.pairs...)
+
+			err := fstest.TestFS(s.FS(), "a", "dir/b", "dir/sub/c", "empty")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFSInvalidPath(t *testing.T) {
+	s := newTestFSStorager(t)
+
+	for _, name := range []string{"/a", "./a", "dir/../a", "", `dir\b`} {
+		_, err := s.FS().Open(name)
+		assert.True(t, errors.Is(err, iofs.ErrInvalid), "%s: %v", name, err)
+	}
+
+	_, err := s.FS().Open("not_exist")
+	assert.True(t, errors.Is(err, iofs.ErrNotExist), "%v", err)
+}
+
+func TestFSWalkDir(t *testing.T) {
+	s := newTestFSStorager(t)
+
+	var paths []string
+	err := iofs.WalkDir(s.FS(), ".", func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "a", "dir", "dir/b", "dir/sub", "dir/sub/c", "empty"}, paths)
+}
+
+func TestFSHTTPFileSystem(t *testing.T) {
+	s := newTestFSStorager(t)
+
+	srv := httptest.NewServer(http.FileServer(s.FS().HTTPFileSystem()))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/dir/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=7-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "world", string(content))
+}
+
+func TestFSSymlink(t *testing.T) {
+	s := newTestFSStorager(t)
+
+	_, err := s.CreateLink("link_dir", "dir")
+	assert.NoError(t, err)
+	_, err = s.CreateLink("link_file", "a")
+	assert.NoError(t, err)
+
+	// Linked dirs should be opened as dirs.
+	f, err := s.FS().Open("link_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	entries, err := f.(iofs.ReadDirFile).ReadDir(-1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	lf, err := s.FS().Open("link_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	content, err := ioutil.ReadAll(lf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// Stat and ReadFile should follow symlinks like Open.
+	fsys := s.FS()
+	fi, err = fsys.Stat("link_file")
+	assert.NoError(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+	assert.Equal(t, int64(5), fi.Size())
+	fi, err = fsys.Stat("link_dir")
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	content, err = fsys.ReadFile("link_file")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	entries, err = fsys.ReadDir("link_dir")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// But entries are reported as is.
+	entries, err = fsys.ReadDir(".")
+	assert.NoError(t, err)
+	for _, e := range entries {
+		if e.Name() == "link_file" || e.Name() == "link_dir" {
+			assert.Equal(t, iofs.ModeSymlink, e.Type())
+			fi, err = e.Info()
+			assert.NoError(t, err)
+			assert.Equal(t, iofs.ModeSymlink, fi.Mode().Type())
+		}
+	}
+
+	// Broken links have no targets.
+	_, err = s.CreateLink("broken", "not-exist")
+	assert.NoError(t, err)
+	_, err = fsys.Stat("broken")
+	assert.True(t, errors.Is(err, iofs.ErrNotExist), "%v", err)
+}
@@ -0,0 +1,46 @@
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package fs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestFSSpecialFile(t *testing.T) {
+	s := newTestFSStorager(t)
+
+	err := unix.Mkfifo(s.getAbsPath("fifo"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open should be refused instead of blocking on the FIFO.
+	_, err = s.FS().Open("fifo")
+	assert.True(t, errors.Is(err, ErrSpecialFile), "%v", err)
+
+	// Special files should not be reported as regular files.
+	fi, err := s.FS().Stat("fifo")
+	assert.NoError(t, err)
+	assert.Equal(t, iofs.ModeNamedPipe, fi.Mode().Type())
+
+	_, err = s.CreateLink("link", "fifo")
+	assert.NoError(t, err)
+	fi, err = s.FS().Stat("link")
+	assert.NoError(t, err)
+	assert.Equal(t, iofs.ModeNamedPipe, fi.Mode().Type())
+
+	entries, err := s.FS().ReadDir(".")
+	assert.NoError(t, err)
+	for _, e := range entries {
+		if e.Name() == "fifo" {
+			assert.Equal(t, iofs.ModeNamedPipe, e.Type())
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package fs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	typ "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// Available layouts.
+const (
+	// LayoutFlat stores objects at their paths directly.
+	LayoutFlat = "flat"
+	// LayoutSharded stores objects in hash-sharded sub dirs of their parent dirs.
+	//
+	// Object `a/b` will be stored as `a/.shards/xx/yy/b`, where `xxyy` is the hash of `b`,
+	// so that a dir will not contain too many entries. Dirs are not sharded.
+	LayoutSharded = "sharded"
+)
+
+// shardsDir is the dir to store sharded objects in every dir.
+const shardsDir = ".shards"
+
+func checkLayout(layout string) error {
+	switch layout {
+	case LayoutFlat, LayoutSharded:
+		return nil
+	default:
+		return fmt.Errorf("layout %s is not supported", layout)
+	}
+}
+
+// getShardedPath returns the sharded path of the object, existing dirs will not be sharded.
+func (s *Storage) getShardedPath(absPath string) string {
+	if absPath == s.workDir || isStdPath(absPath) {
+		return absPath
+	}
+	if fi, err := os.Lstat(absPath); err == nil && fi.IsDir() {
+		return absPath
+	}
+
+	dir, name := filepath.Split(absPath)
+	return filepath.Join(dir, shardsDir, shardOf(name), name)
+}
+
+// shardOf returns the shard dirs of this name, like `xx/yy`.
+func shardOf(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	sum := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(sum[:2], sum[2:4])
+}
+
+// getLogicalRel converts the slash separated path relative to work dir from
+// sharded layout into its logical path.
+func getLogicalRel(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i := 0; i+3 < len(parts); i++ {
+		if parts[i] == shardsDir {
+			parts = append(parts[:i], parts[i+3:]...)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// getLogicalPath converts the absolute path from sharded layout into its logical path,
+// paths outside of work dir are returned unchanged.
+func (s *Storage) getLogicalPath(absPath string) string {
+	if s.layout != LayoutSharded {
+		return absPath
+	}
+	rel, ok := s.getWorkDirRel(absPath)
+	if !ok {
+		return absPath
+	}
+	return filepath.Join(s.workDir, filepath.FromSlash(getLogicalRel(filepath.ToSlash(rel))))
+}
+
+// isShardPath checks whether the path is a shard dir, like `a/.shards/xx`.
+func isShardPath(absPath string) bool {
+	for i := 0; i < 3; i++ {
+		if filepath.Base(absPath) == shardsDir {
+			return true
+		}
+		absPath = filepath.Dir(absPath)
+	}
+	return false
+}
+
+// pruneShardDirs removes the shard dirs of the removed object if they are empty,
+// so that its parent dir could be deleted.
+func (s *Storage) pruneShardDirs(rp string) {
+	if s.layout != LayoutSharded {
+		return
+	}
+	dir := filepath.Dir(rp)
+	for i := 0; i < 3 && isShardPath(dir); i++ {
+		// Shard dirs which still contain objects will be kept.
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// removeEmptyShards removes the shards dir under the dir if there are no objects in it,
+// so that the dir could be deleted.
+func removeEmptyShards(dir string) (err error) {
+	root := filepath.Join(dir, shardsDir)
+	xs, err := ioutil.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, x := range xs {
+		ys, err := ioutil.ReadDir(filepath.Join(root, x.Name()))
+		if err != nil {
+			return err
+		}
+		for _, y := range ys {
+			// Shard dirs which still contain objects will fail with dir not empty.
+			err = os.Remove(filepath.Join(root, x.Name(), y.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		err = os.Remove(filepath.Join(root, x.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(root)
+}
+
+type listShardInput struct {
+	rp  string
+	dir string
+
+	// hidden are the names which should be skipped while listing.
+	hidden []string
+	// followSymlinks will add the mode of targets to symlinks.
+	followSymlinks bool
+	// skipSpecialFiles will skip FIFOs, sockets and device nodes.
+	skipSpecialFiles bool
+
+	started bool
+	// pending are the shard dirs to be read, the last one will be read first.
+	pending []string
+
+	// continuationToken is the position after the last page. It's the last dir name
+	// while dirs have been listed, or `<shard dir>/<last name>` in shards.
+	continuationToken string
+}
+
+func (input *listShardInput) ContinuationToken() string {
+	return input.continuationToken
+}
+
+// isBefore checks whether the shard dir, or the entry in it while name is not
+// empty, is before the continuation token.
+func (input *listShardInput) isBefore(shard, name string) bool {
+	i := strings.LastIndex(input.continuationToken, "/")
+	if i < 0 {
+		// Dirs have been listed, all shards are after the token.
+		return false
+	}
+	tokShard, tokName := input.continuationToken[:i], input.continuationToken[i+1:]
+
+	if name == "" {
+		// Parent shard dirs of the token should not be skipped.
+		if len(shard) < len(tokShard) {
+			tokShard = tokShard[:len(shard)]
+		}
+		return shard < tokShard
+	}
+	return shard < tokShard || (shard == tokShard && name <= tokName)
+}
+
+// listShardNext lists sub dirs and then objects in shard dirs in the order of names,
+// every page contains all entries of a shard dir.
+//
+// Empty page means the iteration is done, so empty shard dirs will be skipped.
+func (s *Storage) listShardNext(ctx context.Context, page *typ.ObjectPage) (err error) {
+	input := page.Status.(*listShardInput)
+
+	defer func() {
+		err = s.formatError("list_shard_next", err, input.rp)
+	}()
+
+	shards := filepath.Join(input.rp, shardsDir)
+
+	if !input.started {
+		input.started = true
+
+		// Dirs have been listed if the token points into shards.
+		if !strings.Contains(input.continuationToken, "/") {
+			fis, err := readDirInfos(input.rp)
+			if err != nil {
+				return err
+			}
+			sortFileInfos(fis)
+			for _, fi := range fis {
+				// Objects are inside shards, so only dirs need to be listed here.
+				if !fi.IsDir() || fi.Name() == shardsDir || input.isHidden(fi.Name()) {
+					continue
+				}
+				if input.continuationToken != "" && fi.Name() <= input.continuationToken {
+					continue
+				}
+				o := s.newObject(false)
+				o.ID = filepath.Join(input.rp, fi.Name())
+				o.Path = path.Join(input.dir, fi.Name())
+				o.Mode |= typ.ModeDir
+				page.Data = append(page.Data, o)
+				input.continuationToken = fi.Name()
+			}
+		}
+		input.pending = []string{shards}
+	}
+
+	for len(input.pending) > 0 {
+		dir := input.pending[len(input.pending)-1]
+		input.pending = input.pending[:len(input.pending)-1]
+
+		fis, err := readDirInfos(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		sortFileInfos(fis)
+
+		// Shard dirs are two levels deep.
+		rel, err := filepath.Rel(shards, dir)
+		if err != nil {
+			return err
+		}
+		shard := filepath.ToSlash(rel)
+		if shard == "." {
+			shard = ""
+		}
+		if strings.Count(shard, "/") < 1 {
+			// Push in reverse order, so that the first one will be read first.
+			for i := len(fis) - 1; i >= 0; i-- {
+				fi := fis[i]
+				if !fi.IsDir() || input.isBefore(path.Join(shard, fi.Name()), "") {
+					continue
+				}
+				input.pending = append(input.pending, filepath.Join(dir, fi.Name()))
+			}
+			continue
+		}
+
+		for _, fi := range fis {
+			if input.isBefore(shard, fi.Name()) {
+				continue
+			}
+
+			ft, special := specialFileType(fi.Mode())
+			if special && input.skipSpecialFiles {
+				continue
+			}
+
+			o := s.newObject(false)
+			o.ID = filepath.Join(dir, fi.Name())
+			o.Path = path.Join(input.dir, fi.Name())
+
+			switch {
+			case fi.IsDir():
+				o.Mode |= typ.ModeDir
+			case fi.Mode().IsRegular():
+				o.Mode |= typ.ModeRead | typ.ModeAppend | typ.ModePage
+			case fi.Mode()&os.ModeSymlink != 0:
+				o.Mode |= typ.ModeLink
+				if input.followSymlinks {
+					s.followListedLink(o)
+				}
+			case special:
+				setObjectSystemMetadata(o, ObjectSystemMetadata{FileType: ft})
+			}
+			page.Data = append(page.Data, o)
+			input.continuationToken = shard + "/" + fi.Name()
+		}
+		if len(page.Data) > 0 {
+			return nil
+		}
+	}
+	return typ.IterateDone
+}
+
+func sortFileInfos(fis []os.FileInfo) {
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+}
+
+func (input *listShardInput) isHidden(name string) bool {
+	for _, v := range input.hidden {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateLayout will move all objects under the dir into current layout, and returns
+// the count of moved objects.
+//
+// Versions and trash entries will not be migrated.
+func (s *Storage) MigrateLayout(path string) (n int, err error) {
+	ctx := context.Background()
+	return s.MigrateLayoutWithContext(ctx, path)
+}
+
+// MigrateLayoutWithContext will move all objects under the dir into current layout, and returns
+// the count of moved objects.
+//
+// Versions and trash entries will not be migrated.
+func (s *Storage) MigrateLayoutWithContext(ctx context.Context, path string) (n int, err error) {
+	defer func() {
+		err = s.formatError("migrate_layout", err, path)
+	}()
+
+	rp := s.getAbsDirPath(path)
+
+	fi, err := os.Stat(rp)
+	if err != nil {
+		return 0, err
+	}
+	if !fi.IsDir() {
+		return 0, services.ErrObjectModeInvalid
+	}
+	return s.migrateLayout(ctx, rp)
+}
+
+func (s *Storage) migrateLayout(ctx context.Context, dir string) (n int, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	fis, err := readDirInfos(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, fi := range fis {
+		fp := filepath.Join(dir, fi.Name())
+		if s.isHiddenPath(fp) {
+			continue
+		}
+
+		switch {
+		case fi.Name() == shardsDir && fi.IsDir():
+			if s.layout == LayoutSharded {
+				continue
+			}
+			m, err := s.unshardDir(ctx, fp)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		case fi.IsDir():
+			m, err := s.migrateLayout(ctx, fp)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		case s.layout == LayoutSharded:
+			err = s.migrateObject(fp, filepath.Join(dir, shardsDir, shardOf(fi.Name()), fi.Name()))
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// unshardDir moves all objects in the shards dir back to its parent.
+func (s *Storage) unshardDir(ctx context.Context, shards string) (n int, err error) {
+	parent := filepath.Dir(shards)
+
+	err = filepath.Walk(shards, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		// Only entries in leaf shard dirs are objects.
+		rel, err := filepath.Rel(shards, path)
+		if err != nil {
+			return err
+		}
+		if strings.Count(rel, string(filepath.Separator)) != 2 {
+			return nil
+		}
+
+		err = s.migrateObject(path, filepath.Join(parent, info.Name()))
+		if err != nil {
+			return err
+		}
+		n++
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, os.RemoveAll(shards)
+}
+
+func (s *Storage) migrateObject(src, dst string) (err error) {
+	if _, err = os.Lstat(dst); err == nil {
+		return fmt.Errorf("%w: %s", ErrObjectExist, s.relPath(dst))
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(src, dst)
+	if err != nil {
+		return err
+	}
+
+	if s.checksumAlgorithm != "" {
+		return s.moveChecksum(src, dst)
+	}
+	return nil
+}
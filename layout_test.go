@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func listTestPaths(t *testing.T, s *Storage, path string) (paths []string) {
+	it, err := s.List(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		o, err := it.Next()
+		if errors.Is(err, IterateDone) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, o.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestLayoutSharded(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello, shards!")
+	for _, path := range []string{"a", "b", "c", "dir/d"} {
+		_, err = s.Write(path, bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+	}
+
+	o, err := s.Stat("dir/d")
+	assert.NoError(t, err)
+	assert.Equal(t, "dir/d", o.Path)
+	assert.Equal(t, filepath.Join(s.workDir, "dir", shardsDir, shardOf("d"), "d"), o.ID)
+	_, err = os.Stat(o.ID)
+	assert.NoError(t, err)
+
+	o, err = s.Stat("dir")
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsDir())
+	assert.Equal(t, filepath.Join(s.workDir, "dir"), o.ID)
+
+	assert.Equal(t, []string{"a", "b", "c", "dir"}, listTestPaths(t, s, ""))
+	assert.Equal(t, []string{"dir/d"}, listTestPaths(t, s, "dir"))
+
+	err = s.Move("a", "dir/e")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = s.Read("dir/e", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	err = s.Delete("b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "dir"}, listTestPaths(t, s, ""))
+}
+
+func TestLayoutShardedContinuation(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []string
+	for i := 0; i < 50; i++ {
+		path := fmt.Sprintf("%02d", i)
+		_, err = s.Write(path, bytes.NewReader([]byte(path)), 2)
+		assert.NoError(t, err)
+		expected = append(expected, path)
+	}
+	for _, path := range []string{"x", "y"} {
+		_, err = s.CreateDir(path)
+		assert.NoError(t, err)
+		expected = append(expected, path)
+	}
+
+	// Every listing resumed from the token should continue after the last page.
+	var paths []string
+	token := ""
+	for {
+		input := &listShardInput{rp: s.workDir, hidden: s.hiddenDirs, continuationToken: token}
+		page := &ObjectPage{Status: input}
+		err = s.listShardNext(context.Background(), page)
+		for _, o := range page.Data {
+			paths = append(paths, o.Path)
+		}
+		if errors.Is(err, IterateDone) {
+			break
+		}
+		assert.NoError(t, err)
+		assert.NotEqual(t, token, input.ContinuationToken())
+		token = input.ContinuationToken()
+	}
+	sort.Strings(paths)
+	sort.Strings(expected)
+	assert.Equal(t, expected, paths)
+
+	it, err := s.List("", ps.WithContinuationToken(token))
+	assert.NoError(t, err)
+	_, err = it.Next()
+	assert.True(t, errors.Is(err, IterateDone), "%v", err)
+}
+
+func TestLayoutShardedTrash(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded), WithTrash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("dir/a", bytes.NewReader(nil), 0)
+	assert.NoError(t, err)
+	err = s.Delete("dir/a")
+	assert.NoError(t, err)
+
+	entries, err := s.ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "dir/a", entries[0].Path)
+
+	err = s.RestoreTrash(entries[0].ID)
+	assert.NoError(t, err)
+	_, err = s.Stat("dir/a")
+	assert.NoError(t, err)
+}
+
+func TestLayoutShardedLink(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello, shards!")
+	_, err = s.Write("dir/a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// Link target should be reported as the logical path, only ID is physical.
+	expected := filepath.Join(s.workDir, "dir", "a")
+	o, err := s.CreateLink("b", "dir/a")
+	assert.NoError(t, err)
+	target, ok := o.GetLinkTarget()
+	assert.True(t, ok)
+	assert.Equal(t, expected, target)
+
+	o, err = s.Stat("b")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(s.workDir, shardsDir, shardOf("b"), "b"), o.ID)
+	target, ok = o.GetLinkTarget()
+	assert.True(t, ok)
+	assert.Equal(t, expected, target)
+
+	var buf bytes.Buffer
+	_, err = s.Read("b", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestLayoutShardedDeleteDir(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"dir/a", "dir/b"} {
+		_, err = s.Write(path, bytes.NewReader(nil), 0)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Move("dir/b", "b"))
+	assert.NoError(t, s.Delete("dir/a"))
+
+	// Shard dirs should be pruned after objects have been removed.
+	_, err = os.Stat(filepath.Join(s.workDir, "dir", shardsDir))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.NoError(t, s.Delete("dir", ps.WithObjectMode(ModeDir)))
+	_, err = os.Stat(filepath.Join(s.workDir, "dir"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// Empty shard dirs left before should not prevent the dir from being deleted.
+	err = os.MkdirAll(filepath.Join(s.workDir, "dir", shardsDir, shardOf("a")), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Delete("dir", ps.WithObjectMode(ModeDir)))
+
+	// But dirs with sharded objects are not empty.
+	_, err = s.Write("dir/a", bytes.NewReader(nil), 0)
+	assert.NoError(t, err)
+	err = s.Delete("dir", ps.WithObjectMode(ModeDir))
+	assert.True(t, errors.Is(err, ErrDirNotEmpty), "%v", err)
+	_, err = s.Stat("dir/a")
+	assert.NoError(t, err)
+}
+
+func TestMigrateLayout(t *testing.T) {
+	workDir := t.TempDir()
+
+	flat, err := newStorager(ps.WithWorkDir(workDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("hello, migration!")
+	for _, path := range []string{"a", "b", "dir/c"} {
+		_, err = flat.Write(path, bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+	}
+
+	sharded, err := newStorager(ps.WithWorkDir(workDir), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := sharded.MigrateLayout("")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, []string{"a", "b", "dir"}, listTestPaths(t, sharded, ""))
+	var buf bytes.Buffer
+	_, err = sharded.Read("dir/c", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// Migrate again will do nothing.
+	n, err = sharded.MigrateLayout("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = flat.MigrateLayout("")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"a", "b", "dir"}, listTestPaths(t, flat, ""))
+	_, err = os.Stat(filepath.Join(workDir, shardsDir))
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+}
+
+func TestGetLogicalRel(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"a", "a"},
+		{".shards/ab/cd/a", "a"},
+		{"dir/.shards/ab/cd/a", "dir/a"},
+		{"dir/.shards/ab", "dir/.shards/ab"},
+	}
+	for _, tt := range cases {
+		assert.Equal(t, tt.expected, getLogicalRel(tt.input), tt.input)
+	}
+}
+
+func TestInvalidLayout(t *testing.T) {
+	_, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout("unknown"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Available link target modes.
+const (
+	// LinkTargetAbsolute stores the target as an absolute path under work dir.
+	LinkTargetAbsolute = "absolute"
+	// LinkTargetVerbatim stores the target as is, a relative target will be resolved
+	// from the dir of the link instead of work dir.
+	LinkTargetVerbatim = "verbatim"
+	// LinkTargetRelative stores the target as a path relative to the dir of the link,
+	// so that the link still works after the whole tree has been moved.
+	LinkTargetRelative = "relative"
+)
+
+func checkLinkTargetMode(mode string) error {
+	switch mode {
+	case LinkTargetAbsolute, LinkTargetVerbatim, LinkTargetRelative:
+		return nil
+	default:
+		return fmt.Errorf("link target mode %s is not supported", mode)
+	}
+}
+
+// formatLinkTarget returns the text to be stored in the symlink at rp.
+func (s *Storage) formatLinkTarget(rp, target, mode string) (string, error) {
+	switch mode {
+	case LinkTargetVerbatim:
+		return filepath.FromSlash(target), nil
+	case LinkTargetRelative:
+		return filepath.Rel(filepath.Dir(rp), s.getAbsPath(target))
+	default:
+		return s.getAbsPath(target), nil
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the count of hard links to the file, symlinks will not be followed.
+func linkCount(path string) (uint64, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	return statLinkCount(path, fi)
+}
+
+// statLinkCount returns the count of hard links to the file described by fi.
+func statLinkCount(path string, fi os.FileInfo) (uint64, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1, nil
+	}
+	return uint64(st.Nlink), nil
+}
+
+// deviceID returns the id of the device which contains the file, symlinks will be followed.
+func deviceID(path string) (uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, nil
+	}
+	return uint64(st.Dev), nil
+}
@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the count of hard links to the file, symlinks will not be followed.
+func linkCount(path string) (uint64, error) {
+	d, err := getFileInformation(path, syscall.FILE_FLAG_OPEN_REPARSE_POINT)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(d.NumberOfLinks), nil
+}
+
+// statLinkCount returns the count of hard links to the file described by fi.
+//
+// The count is not carried by os.FileInfo on windows, so the file will be opened.
+func statLinkCount(path string, fi os.FileInfo) (uint64, error) {
+	return linkCount(path)
+}
+
+// deviceID returns the serial number of the volume which contains the file, symlinks will be followed.
+func deviceID(path string) (uint64, error) {
+	d, err := getFileInformation(path, 0)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(d.VolumeSerialNumber), nil
+}
+
+func getFileInformation(path string, flag uint32) (d syscall.ByHandleFileInformation, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return d, err
+	}
+
+	h, err := syscall.CreateFile(p, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|flag, 0)
+	if err != nil {
+		return d, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.CloseHandle(h)
+
+	err = syscall.GetFileInformationByHandle(h, &d)
+	if err != nil {
+		return d, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	return d, nil
+}
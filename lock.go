@@ -0,0 +1,148 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+const (
+	lockRetryMinInterval = time.Millisecond
+	lockRetryMaxInterval = 100 * time.Millisecond
+)
+
+// Lock is an advisory lock held on a path.
+//
+// Lock is bound to the opened file instead of the process, so it also works across
+// goroutines. Call Close to release the lock.
+//
+// ErrCapabilityInsufficient will be returned on platforms without advisory locks,
+// like aix and js/wasm.
+type Lock struct {
+	s    *Storage
+	path string
+
+	f    *os.File
+	once sync.Once
+}
+
+// Path returns the path of this lock.
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Close releases the lock and closes the underlying file.
+//
+// It's safe to call Close multiple times.
+func (l *Lock) Close() (err error) {
+	l.once.Do(func() {
+		err = unlockFile(l.f)
+		closeErr := l.f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	})
+	return l.s.formatError("unlock", err, l.path)
+}
+
+// Lock will acquire an exclusive lock on the path, the lock file will be created if not exist.
+//
+// Lock will block until the lock is acquired.
+func (s *Storage) Lock(path string) (l *Lock, err error) {
+	ctx := context.Background()
+	return s.LockWithContext(ctx, path)
+}
+
+// LockWithContext will acquire an exclusive lock on the path, the lock file will be created if not exist.
+//
+// LockWithContext will retry until the lock is acquired or the context is done, ErrLockNotAcquired
+// will be returned if the lock can't be acquired before the context's deadline.
+func (s *Storage) LockWithContext(ctx context.Context, path string) (l *Lock, err error) {
+	defer func() {
+		err = s.formatError("lock", err, path)
+	}()
+
+	return s.lock(ctx, path, true)
+}
+
+// RLock will acquire a shared lock on the path, the lock file will be created if not exist.
+//
+// RLock will block until the lock is acquired.
+func (s *Storage) RLock(path string) (l *Lock, err error) {
+	ctx := context.Background()
+	return s.RLockWithContext(ctx, path)
+}
+
+// RLockWithContext will acquire a shared lock on the path, the lock file will be created if not exist.
+//
+// RLockWithContext will retry until the lock is acquired or the context is done, ErrLockNotAcquired
+// will be returned if the lock can't be acquired before the context's deadline.
+func (s *Storage) RLockWithContext(ctx context.Context, path string) (l *Lock, err error) {
+	defer func() {
+		err = s.formatError("rlock", err, path)
+	}()
+
+	return s.lock(ctx, path, false)
+}
+
+func (s *Storage) lock(ctx context.Context, path string, exclusive bool) (l *Lock, err error) {
+	if !lockSupported {
+		return nil, services.ErrCapabilityInsufficient
+	}
+
+	// Lock files are objects which will be created if not exist, so they are sharded
+	// like other objects, dirs can't be locked.
+	rp := s.getAbsPath(path)
+	if err = checkStdPath(rp); err != nil {
+		return nil, err
+	}
+
+	// Don't truncate the file here, lock file could carry content.
+	f, stream, err := s.createFileWithFlag(rp, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	// Streams can't be locked.
+	if stream {
+		_ = closeFile(f)
+		return nil, services.ErrObjectModeInvalid
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+		}
+	}()
+
+	interval := lockRetryMinInterval
+	for {
+		ok, err := tryLockFile(f, exclusive)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %v", ErrLockNotAcquired, ctx.Err())
+		case <-timer.C:
+		}
+
+		if interval *= 2; interval > lockRetryMaxInterval {
+			interval = lockRetryMaxInterval
+		}
+	}
+
+	return &Lock{
+		s:    s,
+		path: path,
+		f:    f,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockSupported means advisory locks are supported on this platform.
+const lockSupported = true
+
+// lockFile applies an advisory lock on the whole file and blocks until it's acquired.
+//
+// We prefer open file description locks which are bound to the *os.File instead of
+// the process, so that different goroutines in the same process can also be excluded.
+// Fallback to flock while the kernel doesn't support OFD locks (before 3.15).
+func lockFile(f *os.File, exclusive bool) error {
+	lk := unix.Flock_t{
+		Type:   unix.F_RDLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0, // 0 means lock the whole file.
+	}
+	if exclusive {
+		lk.Type = unix.F_WRLCK
+	}
+
+	for {
+		err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLKW, &lk)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if errors.Is(err, unix.EINVAL) {
+			return flockFile(f, exclusive)
+		}
+		return err
+	}
+}
+
+// tryLockFile tries to apply an advisory lock on the whole file without blocking.
+func tryLockFile(f *os.File, exclusive bool) (ok bool, err error) {
+	lk := unix.Flock_t{
+		Type:   unix.F_RDLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+	if exclusive {
+		lk.Type = unix.F_WRLCK
+	}
+
+	err = unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &lk)
+	if errors.Is(err, unix.EINVAL) {
+		return tryFlockFile(f, exclusive)
+	}
+	// Conflicting lock is held by others.
+	if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EACCES) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unlockFile releases the advisory lock acquired by lockFile.
+func unlockFile(f *os.File) error {
+	lk := unix.Flock_t{
+		Type:   unix.F_UNLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+
+	err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &lk)
+	if errors.Is(err, unix.EINVAL) {
+		return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	}
+	return err
+}
+
+func flockFile(f *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+
+	for {
+		err := unix.Flock(int(f.Fd()), how)
+		if !errors.Is(err, unix.EINTR) {
+			return err
+		}
+	}
+}
+
+func tryFlockFile(f *os.File, exclusive bool) (ok bool, err error) {
+	how := unix.LOCK_SH | unix.LOCK_NB
+	if exclusive {
+		how = unix.LOCK_EX | unix.LOCK_NB
+	}
+
+	err = unix.Flock(int(f.Fd()), how)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,28 @@
+//go:build aix || (js && wasm)
+// +build aix js,wasm
+
+package fs
+
+import (
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// lockSupported means advisory locks are supported on this platform.
+const lockSupported = false
+
+// lockFile returns ErrCapabilityInsufficient on platforms that advisory locks are not supported.
+func lockFile(f *os.File, exclusive bool) error {
+	return services.ErrCapabilityInsufficient
+}
+
+// tryLockFile returns ErrCapabilityInsufficient on platforms that advisory locks are not supported.
+func tryLockFile(f *os.File, exclusive bool) (ok bool, err error) {
+	return false, services.ErrCapabilityInsufficient
+}
+
+// unlockFile is a no-op on platforms that advisory locks are not supported.
+func unlockFile(f *os.File) error {
+	return nil
+}
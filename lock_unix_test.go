@@ -0,0 +1,145 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func buildLockHelper(t *testing.T) string {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("go toolchain not found: %v", err)
+	}
+
+	bin := filepath.Join(t.TempDir(), "lockhelper")
+	out, err := exec.Command(goBin, "build", "-o", bin, "./testdata/lockhelper").CombinedOutput()
+	if err != nil {
+		t.Fatalf("build lock helper: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// startLockHelper starts a helper process which holds the lock until the returned func is called.
+func startLockHelper(t *testing.T, bin, workDir, path, mode string) (release func()) {
+	cmd := exec.Command(bin, workDir, path, mode)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		_ = cmd.Process.Kill()
+		t.Fatalf("lock helper not locked: %q, %v", line, err)
+	}
+
+	return func() {
+		_ = stdin.Close()
+		assert.NoError(t, cmd.Wait())
+	}
+}
+
+func TestLockAcrossProcesses(t *testing.T) {
+	bin := buildLockHelper(t)
+
+	workDir := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(workDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("exclusive blocks all", func(t *testing.T) {
+		release := startLockHelper(t, bin, workDir, "exclusive.lock", "exclusive")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := s.LockWithContext(ctx, "exclusive.lock")
+		assert.True(t, errors.Is(err, ErrLockNotAcquired))
+
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = s.RLockWithContext(ctx, "exclusive.lock")
+		assert.True(t, errors.Is(err, ErrLockNotAcquired))
+
+		release()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		l, err := s.LockWithContext(ctx, "exclusive.lock")
+		assert.NoError(t, err)
+		assert.NoError(t, l.Close())
+	})
+
+	t.Run("shared blocks exclusive", func(t *testing.T) {
+		release := startLockHelper(t, bin, workDir, "shared.lock", "shared")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		l, err := s.RLockWithContext(ctx, "shared.lock")
+		assert.NoError(t, err)
+		assert.NoError(t, l.Close())
+
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = s.LockWithContext(ctx, "shared.lock")
+		assert.True(t, errors.Is(err, ErrLockNotAcquired))
+
+		release()
+	})
+}
+
+func TestLockAcrossGoroutines(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := s.Lock("goroutine.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := s.Lock("goroutine.lock")
+		assert.NoError(t, err)
+		acquired <- l
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held by another goroutine")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, l.Close())
+	// Close should be idempotent.
+	assert.NoError(t, l.Close())
+
+	select {
+	case l := <-acquired:
+		assert.NoError(t, l.Close())
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after released")
+	}
+}
@@ -0,0 +1,258 @@
+package fs
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	// mmapCacheDefaultMaxSize is the default max size of objects in mmap cache.
+	mmapCacheDefaultMaxSize = 1024 * 1024
+	// mmapCopyBufferSize is the size of chunks copied from mapped data.
+	mmapCopyBufferSize = 64 * 1024
+)
+
+// errMmapTruncated means the mapped file has been truncated by others while reading.
+var errMmapTruncated = errors.New("mapped object has been truncated while reading")
+
+// mmapCache is a LRU cache of memory-mapped objects for reading.
+//
+// Entries are invalidated by writes through the same storager, and validated by stat
+// before used, so that objects replaced by others will not be served.
+type mmapCache struct {
+	capacity int
+	maxSize  int64
+
+	mu sync.Mutex
+	// ll contains *mmapEntry, the front is the most recently used.
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type mmapEntry struct {
+	path string
+	fi   os.FileInfo
+	data []byte
+
+	// refs is the count of readers using data, data will be unmapped after
+	// the entry has been evicted and refs dropped to zero.
+	refs    int
+	evicted bool
+}
+
+func newMmapCache(capacity int, maxSize int64) *mmapCache {
+	return &mmapCache{
+		capacity: capacity,
+		maxSize:  maxSize,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// acquireMmap returns the entry of the file, the entry must be released after used.
+//
+// ok will be false if the file could not be cached, for example it's too large,
+// encrypted or compressed.
+func (s *Storage) acquireMmap(rp string) (e *mmapEntry, ok bool, err error) {
+	c := s.mmapCache
+
+	fi, err := os.Stat(rp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	if el, exist := c.items[rp]; exist {
+		e = el.Value.(*mmapEntry)
+		if os.SameFile(e.fi, fi) && e.fi.Size() == fi.Size() && e.fi.ModTime().Equal(fi.ModTime()) {
+			e.refs++
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			return e, true, nil
+		}
+		c.removeLocked(el)
+	}
+	c.mu.Unlock()
+
+	if !fi.Mode().IsRegular() || fi.Size() == 0 || fi.Size() > c.maxSize {
+		return nil, false, nil
+	}
+
+	e, ok, err = s.mapFile(rp)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another reader could have mapped the same file, keep the latest one.
+	if el, exist := c.items[rp]; exist {
+		c.removeLocked(el)
+	}
+	e.refs++
+	c.items[rp] = c.ll.PushFront(e)
+	for c.ll.Len() > c.capacity {
+		c.removeLocked(c.ll.Back())
+	}
+	return e, true, nil
+}
+
+// mapFile maps the content of the file, ok will be false if the content is transformed.
+func (s *Storage) mapFile(rp string) (e *mmapEntry, ok bool, err error) {
+	f, err := os.Open(rp)
+	if err != nil {
+		return nil, false, err
+	}
+	// The mapping is still valid after the file has been closed.
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() == 0 || fi.Size() > s.mmapCache.maxSize {
+		return nil, false, nil
+	}
+
+	// Decrypted or decompressed content can't be mapped.
+	content, err := s.openContent(f, rp)
+	if err != nil || content.Transformed() {
+		return nil, false, err
+	}
+
+	data, err := mmapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, false, err
+	}
+	return &mmapEntry{path: rp, fi: fi, data: data}, true, nil
+}
+
+// releaseMmap releases the entry acquired by acquireMmap.
+func (s *Storage) releaseMmap(e *mmapEntry) {
+	c := s.mmapCache
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		_ = munmapFile(e.data)
+	}
+}
+
+// invalidateMmap removes the cached entry of the file, it must be called before the
+// file is modified in place.
+func (s *Storage) invalidateMmap(rp string) {
+	c := s.mmapCache
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[rp]; ok {
+		c.removeLocked(el)
+	}
+}
+
+func (c *mmapCache) removeLocked(el *list.Element) {
+	e := c.ll.Remove(el).(*mmapEntry)
+	delete(c.items, e.path)
+
+	e.evicted = true
+	if e.refs == 0 {
+		_ = munmapFile(e.data)
+	}
+}
+
+// readMmap reads the object from mmap cache, ok will be false if the object can't be cached.
+func (s *Storage) readMmap(rp string, w io.Writer, opt pairStorageRead) (n int64, ok bool, err error) {
+	e, ok, err := s.acquireMmap(rp)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	defer s.releaseMmap(e)
+
+	data := e.data
+	if opt.HasOffset {
+		if opt.Offset < 0 {
+			return 0, true, fmt.Errorf("%w: offset %d is negative", ErrRangeInvalid, opt.Offset)
+		}
+		if opt.Offset > int64(len(data)) {
+			opt.Offset = int64(len(data))
+		}
+		data = data[opt.Offset:]
+	}
+	if opt.HasSize && opt.Size < int64(len(data)) {
+		// Nothing will be read with negative size, the same as reading from files.
+		if opt.Size < 0 {
+			opt.Size = 0
+		}
+		data = data[:opt.Size]
+	}
+
+	m, err := writeMapped(w, data, opt.IoCallback)
+	if err == nil && m < len(data) {
+		err = io.ErrShortWrite
+	}
+	return int64(m), true, err
+}
+
+// writeMapped writes the mapped data into w.
+//
+// Mapped data is copied by copyMapped in chunks, so that panics raised by w and
+// callback will never be recovered by us and keep their original stacks.
+func writeMapped(w io.Writer, data []byte, callback func([]byte)) (n int, err error) {
+	size := len(data)
+	if size > mmapCopyBufferSize {
+		size = mmapCopyBufferSize
+	}
+	buf := make([]byte, size)
+
+	for len(data) > 0 {
+		m, err := copyMapped(buf, data)
+		if err != nil {
+			return n, err
+		}
+		data = data[m:]
+
+		if callback != nil {
+			callback(buf[:m])
+		}
+		m, err = w.Write(buf[:m])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// copyMapped copies the mapped data into buf.
+//
+// The file could be truncated by others while reading, which will raise SIGBUS while
+// accessing the mapped pages beyond the end of file. The fault will be returned as
+// error instead of crashing the process. Nothing but the copy runs here, so all
+// recovered runtime errors are faults of the mapped data.
+func copyMapped(buf, data []byte) (n int, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(runtime.Error); !ok {
+			panic(r)
+		}
+		err = errMmapTruncated
+	}()
+
+	return copy(buf, data), nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fs
+
+import (
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// mmapSupported means files could be memory-mapped on this platform.
+const mmapSupported = false
+
+// mmapFile is not supported on this platform.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, services.ErrCapabilityInsufficient
+}
+
+// munmapFile is not supported on this platform.
+func munmapFile(data []byte) error {
+	return services.ErrCapabilityInsufficient
+}
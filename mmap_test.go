@@ -0,0 +1,176 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func readString(t *testing.T, s *Storage, path string) string {
+	var buf bytes.Buffer
+	_, err := s.Read(path, &buf)
+	assert.NoError(t, err)
+	return buf.String()
+}
+
+func TestMmapCache(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithMmapCacheCapacity(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("a", bytes.NewReader([]byte("hello world")), 11)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", readString(t, s, "a"))
+	assert.Equal(t, 1, s.mmapCache.ll.Len())
+
+	// Cached entry should be reused.
+	e := s.mmapCache.items[s.getAbsPath("a")].Value.(*mmapEntry)
+	assert.Equal(t, "hello world", readString(t, s, "a"))
+	assert.Same(t, e, s.mmapCache.items[s.getAbsPath("a")].Value.(*mmapEntry))
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf, ps.WithOffset(6), ps.WithSize(3))
+	assert.NoError(t, err)
+	assert.Equal(t, "wor", buf.String())
+
+	// Invalid ranges should not panic.
+	_, err = s.Read("a", &bytes.Buffer{}, ps.WithOffset(-1))
+	assert.True(t, errors.Is(err, ErrRangeInvalid), "%v", err)
+	buf.Reset()
+	_, err = s.Read("a", &buf, ps.WithSize(-1))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+
+	// Writes should invalidate the cached entry.
+	_, err = s.Write("a", bytes.NewReader([]byte("bye")), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", readString(t, s, "a"))
+
+	assert.NoError(t, s.Truncate("a", 1))
+	assert.Equal(t, "b", readString(t, s, "a"))
+
+	w, err := s.NewWriter("a")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("streamed"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "streamed", readString(t, s, "a"))
+
+	// Least recently used entries should be evicted.
+	for i := 0; i < 3; i++ {
+		path := fmt.Sprintf("b%d", i)
+		_, err = s.Write(path, bytes.NewReader([]byte(path)), int64(len(path)))
+		assert.NoError(t, err)
+		assert.Equal(t, path, readString(t, s, path))
+	}
+	assert.Equal(t, 2, s.mmapCache.ll.Len())
+	_, ok := s.mmapCache.items[s.getAbsPath("a")]
+	assert.False(t, ok)
+
+	assert.NoError(t, s.Delete("b2"))
+	_, ok = s.mmapCache.items[s.getAbsPath("b2")]
+	assert.False(t, ok)
+}
+
+func TestMmapCacheBypass(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithMmapCacheCapacity(8), WithMmapCacheMaxSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("large", bytes.NewReader([]byte("hello")), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", readString(t, s, "large"))
+	assert.Equal(t, 0, s.mmapCache.ll.Len())
+
+	c, err := newStorager(ps.WithWorkDir(t.TempDir()), WithMmapCacheCapacity(8), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Write("a", bytes.NewReader([]byte("hello")), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", readString(t, c, "a"))
+	assert.Equal(t, 0, c.mmapCache.ll.Len())
+}
+
+func TestMmapCacheConcurrent(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithMmapCacheCapacity(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		path := fmt.Sprintf("%d", i)
+		_, err = s.Write(path, bytes.NewReader([]byte(path)), 1)
+		assert.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				path := fmt.Sprintf("%d", (i+j)%4)
+				var buf bytes.Buffer
+				_, err := s.Read(path, &buf)
+				assert.NoError(t, err)
+				assert.Equal(t, path, buf.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write(p []byte) (int, error) {
+	panic("writer panic")
+}
+
+func TestWriteMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a")
+	content := bytes.Repeat([]byte("a"), 3*mmapCopyBufferSize)
+	err := ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := mmapFile(f, len(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer munmapFile(data)
+
+	var buf bytes.Buffer
+	n, err := writeMapped(&buf, data, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, len(content), n)
+	assert.Equal(t, content, buf.Bytes())
+
+	// Panics raised by the writer should not be recovered.
+	assert.PanicsWithValue(t, "writer panic", func() {
+		_, _ = writeMapped(panicWriter{}, data, nil)
+	})
+
+	// Accessing pages beyond the end of the truncated file should fail instead of crashing.
+	assert.NoError(t, os.Truncate(path, 0))
+	_, err = writeMapped(ioutil.Discard, data, nil)
+	assert.True(t, errors.Is(err, errMmapTruncated), "%v", err)
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapSupported means files could be memory-mapped on this platform.
+const mmapSupported = true
+
+// mmapFile maps the first size bytes of the file read only.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return data, nil
+}
+
+func munmapFile(data []byte) error {
+	return unix.Munmap(data)
+}
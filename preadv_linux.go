@@ -0,0 +1,21 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preadv reads into iovs from offset by one vectored read.
+func preadv(f *os.File, iovs [][]byte, offset int64) (n int, err error) {
+	for {
+		n, err = unix.Preadv(int(f.Fd()), iovs, offset)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return n, &os.PathError{Op: "preadv", Path: f.Name(), Err: err}
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// preadv emulates vectored read by reading into iovs one by one.
+func preadv(f *os.File, iovs [][]byte, offset int64) (n int, err error) {
+	for _, iov := range iovs {
+		m, err := f.ReadAt(iov, offset)
+		n += m
+		offset += int64(m)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
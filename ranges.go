@@ -0,0 +1,327 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+const (
+	// rangeBufferSize is the max size of the buffer used by ReadRanges, ranges larger than
+	// this will be delivered in multiple calls.
+	rangeBufferSize = 1024 * 1024
+	// rangeMaxGap is the max gap between ranges which will be read in one vectored read,
+	// bytes in gaps are read into a scratch buffer and discarded.
+	rangeMaxGap = 4096
+	// rangeMaxIovecs is the max count of buffers passed to one vectored read, which
+	// should not exceed IOV_MAX.
+	rangeMaxIovecs = 1024
+)
+
+// Range is a byte range of the object content.
+type Range struct {
+	Offset int64
+	Size   int64
+}
+
+// ReadRanges will read ranges of the object in one open, content of ranges[i] will be written into ws[i].
+//
+// Ranges must not overlap and must be inside the content, otherwise ErrRangeInvalid will be returned.
+func (s *Storage) ReadRanges(path string, ranges []Range, ws []io.Writer, pairs ...Pair) (n int64, err error) {
+	ctx := context.Background()
+	return s.ReadRangesWithContext(ctx, path, ranges, ws, pairs...)
+}
+
+// ReadRangesWithContext will read ranges of the object in one open, content of ranges[i] will be written into ws[i].
+//
+// Ranges must not overlap and must be inside the content, otherwise ErrRangeInvalid will be returned.
+func (s *Storage) ReadRangesWithContext(ctx context.Context, path string, ranges []Range, ws []io.Writer, pairs ...Pair) (n int64, err error) {
+	defer func() {
+		err = s.formatError("read_ranges", err, path)
+	}()
+
+	if len(ws) != len(ranges) {
+		return 0, fmt.Errorf("%w: got %d writers for %d ranges", ErrRangeInvalid, len(ws), len(ranges))
+	}
+
+	opt, err := s.parsePairStorageReadRanges(pairs)
+	if err != nil {
+		return
+	}
+	return s.readRanges(ctx, path, ranges, func(i int, b []byte) error {
+		_, err := ws[i].Write(b)
+		return err
+	}, opt)
+}
+
+// ReadRangesFunc will read ranges of the object in one open, and call fn with the content.
+//
+// fn will be called in the order of offset, and could be called multiple times for a large range.
+// i is the index of the range in ranges, and b is only valid until fn returns.
+func (s *Storage) ReadRangesFunc(path string, ranges []Range, fn func(i int, b []byte) error, pairs ...Pair) (n int64, err error) {
+	ctx := context.Background()
+	return s.ReadRangesFuncWithContext(ctx, path, ranges, fn, pairs...)
+}
+
+// ReadRangesFuncWithContext will read ranges of the object in one open, and call fn with the content.
+//
+// fn will be called in the order of offset, and could be called multiple times for a large range.
+// i is the index of the range in ranges, and b is only valid until fn returns.
+func (s *Storage) ReadRangesFuncWithContext(ctx context.Context, path string, ranges []Range, fn func(i int, b []byte) error, pairs ...Pair) (n int64, err error) {
+	defer func() {
+		err = s.formatError("read_ranges", err, path)
+	}()
+
+	opt, err := s.parsePairStorageReadRanges(pairs)
+	if err != nil {
+		return
+	}
+	return s.readRanges(ctx, path, ranges, fn, opt)
+}
+
+type pairStorageReadRanges struct {
+	pairs []Pair
+	// Optional pairs
+	HasIoCallback bool
+	IoCallback    func([]byte)
+}
+
+func (s *Storage) parsePairStorageReadRanges(opts []Pair) (pairStorageReadRanges, error) {
+	result := pairStorageReadRanges{pairs: opts}
+
+	for _, v := range opts {
+		switch v.Key {
+		case "io_callback":
+			if result.HasIoCallback {
+				continue
+			}
+			result.HasIoCallback = true
+			result.IoCallback = v.Value.(func([]byte))
+		default:
+			return pairStorageReadRanges{}, services.PairUnsupportedError{Pair: v}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) readRanges(ctx context.Context, path string, ranges []Range, fn func(i int, b []byte) error, opt pairStorageReadRanges) (n int64, err error) {
+	rp := s.getAbsPath(path)
+	if err = checkStdPath(rp); err != nil {
+		return 0, err
+	}
+
+	if err = checkSpecialFile(rp); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(rp)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return 0, services.ErrObjectModeInvalid
+	}
+
+	c, err := s.openContent(f, rp)
+	if err != nil {
+		return 0, err
+	}
+
+	order, err := checkRanges(ranges, c.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	deliver := func(i int, b []byte) error {
+		if opt.HasIoCallback {
+			opt.IoCallback(b)
+		}
+		n += int64(len(b))
+		return fn(i, b)
+	}
+
+	// Decrypted or decompressed content can't be read by preadv directly.
+	if c.Transformed() {
+		err = readRangesContent(ctx, c, ranges, order, deliver)
+	} else {
+		err = readRangesVectored(ctx, f, ranges, order, deliver)
+	}
+	return n, err
+}
+
+// checkRanges validates ranges and returns their indexes sorted by offset.
+func checkRanges(ranges []Range, size int64) (order []int, err error) {
+	order = make([]int, len(ranges))
+	for i, r := range ranges {
+		if r.Offset < 0 || r.Size < 0 {
+			return nil, fmt.Errorf("%w: range %d [%d, +%d) is negative", ErrRangeInvalid, i, r.Offset, r.Size)
+		}
+		if r.Offset > size || r.Size > size-r.Offset {
+			return nil, fmt.Errorf("%w: range %d [%d, +%d) exceeds the content size %d",
+				ErrRangeInvalid, i, r.Offset, r.Size, size)
+		}
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return ranges[order[i]].Offset < ranges[order[j]].Offset
+	})
+	for k := 1; k < len(order); k++ {
+		prev, cur := ranges[order[k-1]], ranges[order[k]]
+		if prev.Offset+prev.Size > cur.Offset {
+			return nil, fmt.Errorf("%w: range %d overlaps with range %d", ErrRangeInvalid, order[k], order[k-1])
+		}
+	}
+	return order, nil
+}
+
+// readRangesContent reads ranges from the logical content one by one.
+func readRangesContent(ctx context.Context, c *objectContent, ranges []Range, order []int, fn func(i int, b []byte) error) (err error) {
+	buf := make([]byte, rangeBufferSize)
+
+	for _, i := range order {
+		r := ranges[i]
+		cr := c.NewReader(r.Offset)
+
+		for left := r.Size; left > 0; {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+
+			b := buf
+			if left < int64(len(b)) {
+				b = b[:left]
+			}
+			_, err = io.ReadFull(cr, b)
+			if err != nil {
+				return err
+			}
+			if err = fn(i, b); err != nil {
+				return err
+			}
+			left -= int64(len(b))
+		}
+	}
+	return nil
+}
+
+// readRangesVectored groups nearby ranges and reads every group by one preadv call.
+func readRangesVectored(ctx context.Context, f *os.File, ranges []Range, order []int, fn func(i int, b []byte) error) (err error) {
+	buf := make([]byte, rangeBufferSize)
+	scratch := make([]byte, rangeMaxGap)
+
+	for k := 0; k < len(order); {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		first := ranges[order[k]]
+		// Large ranges are read by chunks directly.
+		if first.Size > int64(len(buf)) {
+			err = readRangeChunked(f, order[k], first, buf, fn)
+			if err != nil {
+				return err
+			}
+			k++
+			continue
+		}
+
+		// Collect following ranges as long as they fit into the buffer.
+		iovs := [][]byte{buf[:first.Size]}
+		used, end := first.Size, first.Offset+first.Size
+		group := k + 1
+		for ; group < len(order) && len(iovs)+2 <= rangeMaxIovecs; group++ {
+			r := ranges[order[group]]
+			gap := r.Offset - end
+			if gap > rangeMaxGap || used+r.Size > int64(len(buf)) {
+				break
+			}
+			if gap > 0 {
+				iovs = append(iovs, scratch[:gap])
+			}
+			iovs = append(iovs, buf[used:used+r.Size])
+			used, end = used+r.Size, r.Offset+r.Size
+		}
+
+		_, err = preadvFull(f, iovs, first.Offset)
+		if err != nil {
+			return err
+		}
+
+		used = 0
+		for ; k < group; k++ {
+			i := order[k]
+			size := ranges[i].Size
+			if size == 0 {
+				continue
+			}
+			if err = fn(i, buf[used:used+size]); err != nil {
+				return err
+			}
+			used += size
+		}
+	}
+	return nil
+}
+
+func readRangeChunked(f *os.File, i int, r Range, buf []byte, fn func(i int, b []byte) error) (err error) {
+	for off, end := r.Offset, r.Offset+r.Size; off < end; {
+		b := buf
+		if end-off < int64(len(b)) {
+			b = b[:end-off]
+		}
+		_, err = f.ReadAt(b, off)
+		if err != nil {
+			return err
+		}
+		if err = fn(i, b); err != nil {
+			return err
+		}
+		off += int64(len(b))
+	}
+	return nil
+}
+
+// preadvFull reads into all iovs from offset, short reads will be retried and EOF
+// before iovs are filled will be returned as io.ErrUnexpectedEOF.
+func preadvFull(f *os.File, iovs [][]byte, offset int64) (n int64, err error) {
+	for {
+		// Skip empty buffers, otherwise they will be treated as EOF.
+		for len(iovs) > 0 && len(iovs[0]) == 0 {
+			iovs = iovs[1:]
+		}
+		if len(iovs) == 0 {
+			return n, nil
+		}
+
+		m, err := preadv(f, iovs, offset)
+		n += int64(m)
+		offset += int64(m)
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		// Skip the filled buffers.
+		for len(iovs) > 0 && m >= len(iovs[0]) {
+			m -= len(iovs[0])
+			iovs = iovs[1:]
+		}
+		if m > 0 {
+			iovs[0] = iovs[0][m:]
+		}
+	}
+}
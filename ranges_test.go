@@ -0,0 +1,131 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestReadRanges(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"plain", nil},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}},
+		{"encrypted", []Pair{WithEncryptionKey(testKeyA)}},
+	}
+
+	content := make([]byte, 3*rangeBufferSize)
+	rand.Read(content)
+
+	// Ranges are not sorted, and contain adjacent, nearby, far and large ones.
+	ranges := []Range{
+		{Offset: 5000, Size: 100},
+		{Offset: 0, Size: 10},
+		{Offset: 10, Size: 20},
+		{Offset: 2000, Size: 0},
+		{Offset: rangeBufferSize, Size: rangeBufferSize + 10},
+		{Offset: int64(len(content)) - 1, Size: 1},
+		{Offset: int64(len(content)), Size: 0},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir())}, tt.pairs...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+			assert.NoError(t, err)
+
+			bufs := make([]bytes.Buffer, len(ranges))
+			ws := make([]io.Writer, len(ranges))
+			for i := range bufs {
+				ws[i] = &bufs[i]
+			}
+
+			var read int64
+			n, err := s.ReadRanges("a", ranges, ws, ps.WithIoCallback(func(b []byte) {
+				read += int64(len(b))
+			}))
+			assert.NoError(t, err)
+
+			var total int64
+			for i, r := range ranges {
+				assert.Equal(t, string(content[r.Offset:r.Offset+r.Size]), bufs[i].String(), "range %d", i)
+				total += r.Size
+			}
+			assert.Equal(t, total, n)
+			assert.Equal(t, total, read)
+		})
+	}
+}
+
+func TestReadRangesFunc(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("0123456789")
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	var order []int
+	_, err = s.ReadRangesFunc("a", []Range{{8, 2}, {0, 2}, {4, 2}}, func(i int, b []byte) error {
+		order = append(order, i)
+		return nil
+	})
+	assert.NoError(t, err)
+	// Ranges are delivered in the order of offset.
+	assert.Equal(t, []int{1, 2, 0}, order)
+
+	expected := errors.New("stop")
+	_, err = s.ReadRangesFunc("a", []Range{{0, 2}, {4, 2}}, func(i int, b []byte) error {
+		return expected
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), expected.Error())
+}
+
+func TestReadRangesInvalid(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write("a", bytes.NewReader(make([]byte, 100)), 100)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		ranges []Range
+	}{
+		{"negative offset", []Range{{-1, 10}}},
+		{"negative size", []Range{{0, -1}}},
+		{"beyond eof", []Range{{90, 11}}},
+		{"offset beyond eof", []Range{{101, 0}}},
+		{"overlapped", []Range{{50, 10}, {0, 10}, {55, 10}}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			_, err := s.ReadRangesFunc("a", tt.ranges, func(i int, b []byte) error {
+				called = true
+				return nil
+			})
+			assert.True(t, errors.Is(err, ErrRangeInvalid))
+			assert.False(t, called)
+		})
+	}
+
+	_, err = s.ReadRanges("a", []Range{{0, 10}}, nil)
+	assert.True(t, errors.Is(err, ErrRangeInvalid))
+}
@@ -46,6 +46,22 @@ const (
 	DirentTypeWhiteOut = 14
 )
 
+// direntFileType returns the type of special file, returns false if the file is not special.
+func direntFileType(ty uint8) (string, bool) {
+	switch ty {
+	case DirentTypeFIFO:
+		return FileTypeFIFO, true
+	case DirentTypeSocket:
+		return FileTypeSocket, true
+	case DirentTypeCharDevice:
+		return FileTypeCharDevice, true
+	case DirentTypeBlockDevice:
+		return FileTypeBlockDevice, true
+	default:
+		return "", false
+	}
+}
+
 func (s *Storage) listDirNext(ctx context.Context, page *typ.ObjectPage) (err error) {
 	input := page.Status.(*listDirInput)
 
@@ -121,6 +137,14 @@ func (s *Storage) listDirNext(ctx context.Context, page *typ.ObjectPage) (err er
 		if fname == "." || fname == ".." {
 			continue
 		}
+		// Skip internal dirs like versions.
+		if input.isHidden(fname) {
+			continue
+		}
+		ft, special := direntFileType(ty)
+		if special && input.skipSpecialFiles {
+			continue
+		}
 
 		if !input.started {
 			if fname != input.continuationToken {
@@ -144,6 +168,13 @@ func (s *Storage) listDirNext(ctx context.Context, page *typ.ObjectPage) (err er
 			o.Mode |= typ.ModeRead | typ.ModeAppend | typ.ModePage
 		case DirentTypeLink:
 			o.Mode |= typ.ModeLink
+			if input.followSymlinks {
+				s.followListedLink(o)
+			}
+		default:
+			if special {
+				setObjectSystemMetadata(o, ObjectSystemMetadata{FileType: ft})
+			}
 		}
 
 		// Set update name here.
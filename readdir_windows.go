@@ -47,6 +47,10 @@ func (s *Storage) listDirNext(ctx context.Context, page *typ.ObjectPage) (err er
 		if name == "." || name == ".." {
 			continue
 		}
+		// Skip internal dirs like versions.
+		if input.isHidden(name) {
+			continue
+		}
 
 		o := s.newObject(true)
 		// Always keep service original name as ID.
@@ -65,6 +69,9 @@ func (s *Storage) listDirNext(ctx context.Context, page *typ.ObjectPage) (err er
 			// FILE_ATTRIBUTE_REPARSE_POINT means this is a file or directory that has
 			// an associated reparse point, or a file that is a symbolic link.
 			o.Mode |= typ.ModeLink
+			if input.followSymlinks {
+				s.followListedLink(o)
+			}
 		}
 		page.Data = append(page.Data, o)
 
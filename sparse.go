@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"context"
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// PunchHole will deallocate the range of the object, the range will be read as zeros
+// and the size of the object will not be changed.
+//
+// Only objects stored as is could be modified in place, encrypted, compressed or
+// sealed objects and objects linked to blobs will be refused.
+func (s *Storage) PunchHole(path string, offset, size int64) (err error) {
+	ctx := context.Background()
+	return s.PunchHoleWithContext(ctx, path, offset, size)
+}
+
+// PunchHoleWithContext will deallocate the range of the object, the range will be read as zeros
+// and the size of the object will not be changed.
+//
+// Only objects stored as is could be modified in place, encrypted, compressed or
+// sealed objects and objects linked to blobs will be refused.
+func (s *Storage) PunchHoleWithContext(ctx context.Context, path string, offset, size int64) (err error) {
+	defer func() {
+		err = s.formatError("punch_hole", err, path)
+	}()
+
+	if offset < 0 || size < 0 {
+		return ErrRangeInvalid
+	}
+	return s.modifyInPlace(ctx, path, func(f *os.File) error {
+		if size == 0 {
+			return nil
+		}
+		return punchHole(f, offset, size)
+	})
+}
+
+// Truncate will change the size of the object, the extended part will be a hole.
+//
+// Only objects stored as is could be modified in place, encrypted, compressed or
+// sealed objects and objects linked to blobs will be refused.
+func (s *Storage) Truncate(path string, size int64) (err error) {
+	ctx := context.Background()
+	return s.TruncateWithContext(ctx, path, size)
+}
+
+// TruncateWithContext will change the size of the object, the extended part will be a hole.
+//
+// Only objects stored as is could be modified in place, encrypted, compressed or
+// sealed objects and objects linked to blobs will be refused.
+func (s *Storage) TruncateWithContext(ctx context.Context, path string, size int64) (err error) {
+	defer func() {
+		err = s.formatError("truncate", err, path)
+	}()
+
+	if size < 0 {
+		return ErrRangeInvalid
+	}
+	return s.modifyInPlace(ctx, path, func(f *os.File) error {
+		return f.Truncate(size)
+	})
+}
+
+// modifyInPlace calls fn with the opened file, and updates the stored checksum after modified.
+func (s *Storage) modifyInPlace(ctx context.Context, path string, fn func(f *os.File) error) (err error) {
+	rp := s.getAbsPath(path)
+	if err = checkStdPath(rp); err != nil {
+		return err
+	}
+	s.invalidateMmap(rp)
+
+	f, err := os.OpenFile(rp, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return services.ErrObjectModeInvalid
+	}
+	if isSealed(rp, fi) {
+		return ErrObjectSealed
+	}
+	// Blobs are shared by objects and should never be modified in place.
+	if s.cas {
+		if _, ok, err := getBlobSum(rp); err != nil || ok {
+			if err == nil {
+				err = services.ErrObjectModeInvalid
+			}
+			return err
+		}
+	}
+	// Offsets of encrypted or compressed content don't match the file.
+	if _, ok, err := s.statContent(rp); err != nil || ok {
+		if err == nil {
+			err = services.ErrObjectModeInvalid
+		}
+		return err
+	}
+
+	err = fn(f)
+	if err != nil {
+		return err
+	}
+
+	if s.checksumAlgorithm == "" {
+		return nil
+	}
+	checksum, err := computeChecksum(ctx, rp, s.checksumAlgorithm)
+	if err != nil {
+		// Never keep an outdated checksum.
+		_ = s.removeChecksum(rp)
+		return err
+	}
+	return s.saveChecksumString(rp, checksum)
+}
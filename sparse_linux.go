@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	"golang.org/x/sys/unix"
+)
+
+// whence values of lseek to find data and holes, which are not defined by x/sys.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// copySparse copies the content of src into dst, holes in src will be kept in dst.
+//
+// The whole content of src will be copied regardless of its current offset, so dst should
+// be at offset 0, and it will be truncated to the size of src.
+// Holes will be fed into h as zeros if h is not nil.
+func copySparse(dst, src *os.File, h hash.Hash) (n int64, err error) {
+	fi, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+
+	var w io.Writer = dst
+	if h != nil {
+		w = io.MultiWriter(dst, h)
+	}
+	buf := make([]byte, 1024*1024)
+
+	for n < size {
+		data, err := src.Seek(n, seekData)
+		if errors.Is(err, unix.ENXIO) {
+			// There is no data after n, the rest is a hole.
+			data = size
+		} else if errors.Is(err, unix.EINVAL) {
+			// SEEK_DATA is not supported, copy the rest as dense.
+			_, err = src.Seek(n, io.SeekStart)
+			if err != nil {
+				return n, err
+			}
+			m, err := io.CopyBuffer(w, src, buf)
+			return n + m, err
+		} else if err != nil {
+			return n, err
+		}
+
+		if data > n {
+			err = skipHole(dst, h, data-n)
+			if err != nil {
+				return n, err
+			}
+			n = data
+		}
+		if data == size {
+			break
+		}
+
+		hole, err := src.Seek(data, seekHole)
+		if err != nil {
+			return n, err
+		}
+		_, err = src.Seek(data, io.SeekStart)
+		if err != nil {
+			return n, err
+		}
+		m, err := io.CopyBuffer(w, io.LimitReader(src, hole-data), buf)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	// Trailing hole will not be created by seeking.
+	return n, dst.Truncate(size)
+}
+
+// skipHole moves the offset of dst forward, and feeds zeros into h.
+func skipHole(dst *os.File, h hash.Hash, size int64) (err error) {
+	_, err = dst.Seek(size, io.SeekCurrent)
+	if err != nil || h == nil {
+		return err
+	}
+
+	zero := make([]byte, 1024*1024)
+	for size > 0 {
+		m := int64(len(zero))
+		if size < m {
+			m = size
+		}
+		_, _ = h.Write(zero[:m])
+		size -= m
+	}
+	return nil
+}
+
+// punchHole deallocates the range of the file, the size of file will not be changed.
+func punchHole(f *os.File, offset, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, size)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return fmt.Errorf("%w: punch hole is not supported", services.ErrCapabilityInsufficient)
+	}
+	if err != nil {
+		return &os.PathError{Op: "fallocate", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// copySparse copies the content of src into dst as dense, because there is no
+// portable way to find holes on this platform.
+//
+// Both files should be at offset 0, the same as on linux.
+func copySparse(dst, src *os.File, h hash.Hash) (n int64, err error) {
+	var w io.Writer = dst
+	if h != nil {
+		w = io.MultiWriter(dst, h)
+	}
+	return io.CopyBuffer(w, src, make([]byte, 1024*1024))
+}
+
+// punchHole is not supported on this platform.
+func punchHole(f *os.File, offset, size int64) error {
+	return fmt.Errorf("%w: punch hole is not supported", services.ErrCapabilityInsufficient)
+}
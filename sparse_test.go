@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+const sparseTestSize = 16 * 1024 * 1024
+
+// newSparseObject creates an object with data at head and tail, and a hole in the middle.
+func newSparseObject(t *testing.T, s *Storage, path string) []byte {
+	content := make([]byte, sparseTestSize)
+	copy(content, "head")
+	copy(content[sparseTestSize-4:], "tail")
+
+	_, err := s.Write(path, bytes.NewReader(content[:4]), 4)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Truncate(path, sparseTestSize))
+
+	f, err := os.OpenFile(s.getAbsPath(path), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("tail"), sparseTestSize-4)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	return content
+}
+
+func TestSparseCopy(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := newSparseObject(t, s, "a")
+
+	assert.NoError(t, s.Copy("a", "b"))
+
+	var buf bytes.Buffer
+	_, err = s.Read("b", &buf)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, buf.Bytes()))
+
+	o, err := s.Stat("b")
+	assert.NoError(t, err)
+	sm := GetObjectSystemMetadata(o)
+	assert.Equal(t, int64(sparseTestSize), sm.PhysicalSize)
+	if runtime.GOOS == "linux" {
+		assert.Less(t, sm.AllocatedSize, int64(sparseTestSize/2))
+	}
+
+	// Checksum of holes should be computed as zeros.
+	checksum, err := computeChecksum(context.Background(), s.getAbsPath("b"), ChecksumSHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum, sm.Checksum)
+}
+
+func TestPunchHole(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("punch hole is only supported on linux")
+	}
+
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte{1}, sparseTestSize)
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	err = s.PunchHole("a", 4096, sparseTestSize-2*4096)
+	assert.NoError(t, err)
+	for i := 4096; i < sparseTestSize-4096; i++ {
+		content[i] = 0
+	}
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, buf.Bytes()))
+
+	o, err := s.Stat("a")
+	assert.NoError(t, err)
+	sm := GetObjectSystemMetadata(o)
+	assert.Equal(t, int64(sparseTestSize), o.MustGetContentLength())
+	assert.Less(t, sm.AllocatedSize, int64(sparseTestSize/2))
+
+	checksum, err := computeChecksum(context.Background(), s.getAbsPath("a"), ChecksumSHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum, sm.Checksum)
+
+	err = s.PunchHole("a", -1, 10)
+	assert.True(t, errors.Is(err, ErrRangeInvalid))
+}
+
+func TestModifyInPlaceRefused(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write("a", bytes.NewReader([]byte("hello")), 5)
+	assert.NoError(t, err)
+
+	err = s.Truncate("a", 1)
+	assert.True(t, errors.Is(err, services.ErrObjectModeInvalid))
+
+	err = s.Truncate("not-exist", 1)
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+}
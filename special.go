@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+)
+
+// Available types of special files, which are reported as file-type in system metadata.
+const (
+	// FileTypeFIFO is a named pipe.
+	FileTypeFIFO = "fifo"
+	// FileTypeSocket is a unix domain socket.
+	FileTypeSocket = "socket"
+	// FileTypeCharDevice is a character device node.
+	FileTypeCharDevice = "char-device"
+	// FileTypeBlockDevice is a block device node.
+	FileTypeBlockDevice = "block-device"
+)
+
+// specialFileType returns the type of special file, returns false if the file is not special.
+func specialFileType(mode os.FileMode) (string, bool) {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return FileTypeFIFO, true
+	case mode&os.ModeSocket != 0:
+		return FileTypeSocket, true
+	case mode&os.ModeCharDevice != 0:
+		return FileTypeCharDevice, true
+	case mode&os.ModeDevice != 0:
+		return FileTypeBlockDevice, true
+	default:
+		return "", false
+	}
+}
+
+// checkSpecialFile refuses special files before opening them, opening a FIFO will block
+// until the other end is opened, and opening a device could have side effects.
+func checkSpecialFile(absPath string) error {
+	fi, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+	if t, ok := specialFileType(fi.Mode()); ok {
+		return fmt.Errorf("%w: %s is a %s", ErrSpecialFile, absPath, t)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	for _, layout := range []string{LayoutFlat, LayoutSharded} {
+		t.Run(layout, func(t *testing.T) {
+			// Path of unix socket is limited to about 100 bytes.
+			dir, err := ioutil.TempDir("", "fs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			s, err := newStorager(ps.WithWorkDir(dir), WithLayout(layout))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.Write("file", bytes.NewReader([]byte("a")), 1)
+			assert.NoError(t, err)
+
+			fp := s.getAbsPath("fifo")
+			assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+			assert.NoError(t, unix.Mkfifo(fp, 0644))
+
+			sp := s.getAbsPath("socket")
+			assert.NoError(t, os.MkdirAll(filepath.Dir(sp), 0755))
+			l, err := net.Listen("unix", sp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			cases := map[string]string{
+				"fifo":   FileTypeFIFO,
+				"socket": FileTypeSocket,
+			}
+			for path, ft := range cases {
+				o, err := s.Stat(path)
+				assert.NoError(t, err)
+				assert.False(t, o.Mode.IsRead())
+				assert.Equal(t, ft, GetObjectSystemMetadata(o).FileType)
+
+				// Read should be refused instead of blocking on the FIFO.
+				_, err = s.Read(path, &bytes.Buffer{})
+				assert.True(t, errors.Is(err, ErrSpecialFile))
+				err = s.Copy(path, "copied")
+				assert.True(t, errors.Is(err, ErrSpecialFile))
+				_, err = s.ReadRanges(path, []Range{{0, 1}}, []io.Writer{&bytes.Buffer{}})
+				assert.True(t, errors.Is(err, ErrSpecialFile))
+				_, err = s.Open(path)
+				assert.True(t, errors.Is(err, ErrSpecialFile))
+			}
+
+			listed := func(pairs ...Pair) map[string]string {
+				it, err := s.List("", append(pairs, ps.WithListMode(ListModeDir))...)
+				assert.NoError(t, err)
+				m := make(map[string]string)
+				for {
+					o, err := it.Next()
+					if errors.Is(err, IterateDone) {
+						break
+					}
+					assert.NoError(t, err)
+					m[o.Path] = GetObjectSystemMetadata(o).FileType
+				}
+				return m
+			}
+			assert.Equal(t, map[string]string{
+				"file":   "",
+				"fifo":   FileTypeFIFO,
+				"socket": FileTypeSocket,
+			}, listed())
+			assert.Equal(t, map[string]string{
+				"file": "",
+			}, listed(WithSkipSpecialFiles()))
+		})
+	}
+}
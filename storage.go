@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -19,6 +21,41 @@ import (
 func (s *Storage) delete(ctx context.Context, path string, opt pairStorageDelete) (err error) {
 	rp := s.getAbsPath(path)
 
+	// Blob could only be found before the object has been removed.
+	var sum string
+	if s.cas {
+		sum, _, err = getBlobSum(rp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	s.invalidateMmap(rp)
+
+	trashed, err := s.moveToTrash(rp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if trashed {
+		s.pruneShardDirs(rp)
+		return nil
+	}
+
+	err = s.archiveVersion(rp)
+	if err != nil {
+		return err
+	}
+
+	if s.layout == LayoutSharded {
+		// Dirs are never sharded, but their shards dir should be removed before deleted.
+		if fi, serr := os.Lstat(rp); serr == nil && fi.IsDir() {
+			err = removeEmptyShards(rp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	err = os.Remove(rp)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
 		// Omit `file not exist` error here
@@ -28,7 +65,17 @@ func (s *Storage) delete(ctx context.Context, path string, opt pairStorageDelete
 	if err != nil {
 		return err
 	}
+	s.pruneShardDirs(rp)
 
+	if s.checksumAlgorithm != "" {
+		err = s.removeChecksum(rp)
+		if err != nil {
+			return err
+		}
+	}
+	if sum != "" {
+		return s.releaseBlob(sum)
+	}
 	return nil
 }
 
@@ -36,9 +83,17 @@ type listDirInput struct {
 	rp  string
 	dir string
 
+	// hidden are the names which should be skipped while listing.
+	hidden []string
+
 	started           bool
 	continuationToken string
 
+	// followSymlinks will add the mode of targets to symlinks.
+	followSymlinks bool
+	// skipSpecialFiles will skip FIFOs, sockets and device nodes.
+	skipSpecialFiles bool
+
 	f    *os.File
 	buf  *[]byte
 	bufp int
@@ -49,34 +104,183 @@ func (input *listDirInput) ContinuationToken() string {
 }
 
 func (s *Storage) commitAppend(ctx context.Context, o *Object, opt pairStorageCommitAppend) (err error) {
-	return
+	fi, stream, err := s.statFile(o.ID)
+	if err != nil {
+		return err
+	}
+	// Streams can't be synced or sealed, there is nothing to commit.
+	if stream {
+		return nil
+	}
+	if isSealed(o.ID, fi) {
+		return ErrObjectSealed
+	}
+
+	f, _, err := s.openFile(o.ID, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := closeFile(f)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Make sure all appended data has been persisted before we check the size.
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	fi, err = f.Stat()
+	if err != nil {
+		return err
+	}
+	if offset, ok := o.GetAppendOffset(); ok && offset != fi.Size() {
+		return fmt.Errorf("%w: append offset is %d, but file size is %d",
+			ErrAppendOffsetMismatch, offset, fi.Size())
+	}
+
+	if s.checksumAlgorithm != "" {
+		// The algorithm has been checked in newStorager.
+		h, _ := newChecksumHash(s.checksumAlgorithm)
+		_, err = io.CopyBuffer(h, f, make([]byte, 1024*1024))
+		if err != nil {
+			return err
+		}
+		err = s.saveChecksum(o.ID, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opt.HasSealAppend && opt.SealAppend {
+		// Record the seal explicitly, so that read-only files will not be treated as sealed.
+		// It must be set before write bits are cleared.
+		err = setXattr(o.ID, sealXattr, []byte("1"))
+		if err != nil && !errors.Is(err, errXattrUnsupported) {
+			return err
+		}
+		// Clear all write bits so that later write_append will be refused.
+		err = f.Chmod(fi.Mode().Perm() &^ 0222)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Storage) copy(ctx context.Context, src string, dst string, opt pairStorageCopy) (err error) {
 	rs := s.getAbsPath(src)
 	rd := s.getAbsPath(dst)
 
-	srcFile, needClose, err := s.openFile(rs, os.O_RDONLY)
+	srcFile, srcStream, err := s.openFile(rs, os.O_RDONLY)
 	if err != nil {
 		return err
 	}
-	if needClose {
-		defer srcFile.Close()
+	defer closeFile(srcFile)
+
+	dstStream := s.isStreamPath(rd, os.O_WRONLY)
+	if s.cas && !srcStream && !dstStream {
+		// Objects stored as blob could be copied by linking to the blob.
+		ok, err := s.copyBlob(rs, rd)
+		if err != nil || ok {
+			return err
+		}
 	}
 
-	dstFile, needClose, err := s.createFile(rd)
-	if err != nil {
-		return err
+	// Current content should only be archived after the new content has been written,
+	// so the content will be written into a temporary file first.
+	var dstFile *os.File
+	var tmp string
+	if s.versioning && !dstStream {
+		err = s.checkWriteTarget(rd)
+		if err != nil {
+			return err
+		}
+		dstFile, err = s.createTempFile(rd)
+		if err != nil {
+			return err
+		}
+		tmp = dstFile.Name()
+		defer func() {
+			if err != nil {
+				_ = os.Remove(tmp)
+			}
+		}()
+	} else {
+		if s.cas {
+			err = s.unlinkBlob(rd)
+			if err != nil {
+				return err
+			}
+		}
+		dstFile, dstStream, err = s.createFile(rd)
+		if err != nil {
+			return err
+		}
 	}
-	if needClose {
-		defer dstFile.Close()
+	defer closeFile(dstFile)
+
+	w, h := s.newChecksumWriter(dstFile)
+
+	// Content encrypted with current key will be copied as is, otherwise
+	// it will be encrypted again with current key.
+	var r io.Reader = srcFile
+	var ew *encryptWriter
+	if s.encryptionKeyID != "" && !srcStream && !dstStream {
+		ef, ok, err := s.openEncrypted(srcFile)
+		if err != nil {
+			return err
+		}
+		if !ok || ef.keyID != s.encryptionKeyID {
+			if ok {
+				r = io.NewSectionReader(ef, 0, ef.size)
+			}
+			ew, err = s.newEncryptWriter(w)
+			if err != nil {
+				return err
+			}
+			w = ew
+		}
 	}
 
-	_, err = io.CopyBuffer(dstFile, srcFile, make([]byte, 1024*1024))
+	if ew == nil && !srcStream && !dstStream {
+		// Content copied as is could keep holes of sparse files.
+		_, err = copySparse(dstFile, srcFile, h)
+	} else {
+		_, err = io.CopyBuffer(w, r, make([]byte, 1024*1024))
+	}
+	if err == nil && ew != nil {
+		err = ew.Close()
+	}
 	if err != nil {
 		return err
 	}
-	return
+
+	// Compressed frames have been copied as is, so does the mark.
+	if v, err := getXattr(rs, compressionXattr); err == nil && !srcStream && !dstStream {
+		err = setXattr(dstFile.Name(), compressionXattr, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tmp != "" {
+		err = dstFile.Close()
+		if err != nil {
+			return err
+		}
+		err = s.replaceFile(tmp, rd)
+		if err != nil {
+			return err
+		}
+	}
+	if h != nil && !dstStream {
+		return s.saveChecksum(rd, h)
+	}
+	return nil
 }
 
 func (s *Storage) create(path string, opt pairStorageCreate) (o *Object) {
@@ -88,7 +292,11 @@ func (s *Storage) create(path string, opt pairStorageCreate) (o *Object) {
 		o.Mode = ModeRead
 	}
 
-	o.ID = filepath.Join(s.workDir, path)
+	if o.Mode.IsDir() {
+		o.ID = s.getAbsDirPath(path)
+	} else {
+		o.ID = s.getAbsPath(path)
+	}
 	o.Path = path
 	return o
 }
@@ -96,15 +304,50 @@ func (s *Storage) create(path string, opt pairStorageCreate) (o *Object) {
 func (s *Storage) createAppend(ctx context.Context, path string, opt pairStorageCreateAppend) (o *Object, err error) {
 	rp := s.getAbsPath(path)
 
-	f, needClose, err := s.createFile(rp)
-	if err != nil {
-		return
+	// Encrypted chunks can't be appended.
+	if s.encryptionKeyID != "" {
+		return nil, services.ErrCapabilityInsufficient
 	}
-	if needClose {
-		err = f.Close()
+
+	// Sealed object should not be truncated and appended again.
+	if fi, _, err := s.statFile(rp); err == nil && fi.Mode().IsRegular() && isSealed(rp, fi) {
+		return nil, ErrObjectSealed
+	}
+
+	if s.versioning && !s.isStreamPath(rp, os.O_WRONLY) {
+		// Current content should only be archived after the new file has been created.
+		err = s.checkWriteTarget(rp)
 		if err != nil {
 			return
 		}
+		f, err := s.createTempFile(rp)
+		if err != nil {
+			return nil, err
+		}
+		err = f.Close()
+		if err == nil {
+			err = s.replaceFile(f.Name(), rp)
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return nil, err
+		}
+	} else {
+		if s.cas {
+			err = s.unlinkBlob(rp)
+			if err != nil {
+				return
+			}
+		}
+
+		f, _, err := s.createFile(rp)
+		if err != nil {
+			return nil, err
+		}
+		err = closeFile(f)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	o = s.newObject(true)
@@ -117,7 +360,7 @@ func (s *Storage) createAppend(ctx context.Context, path string, opt pairStorage
 }
 
 func (s *Storage) createDir(ctx context.Context, path string, opt pairStorageCreateDir) (o *Object, err error) {
-	rp := s.getAbsPath(path)
+	rp := s.getAbsDirPath(path)
 
 	err = os.MkdirAll(rp, 0755)
 	if err != nil {
@@ -131,10 +374,99 @@ func (s *Storage) createDir(ctx context.Context, path string, opt pairStorageCre
 	return
 }
 
-func (s *Storage) createLink(ctx context.Context, path string, target string, opt pairStorageCreateLink) (o *Object, err error) {
+// createHardLink links path to the same file of target, so that they share the content.
+func (s *Storage) createHardLink(ctx context.Context, path string, target string) (o *Object, err error) {
 	rt := s.getAbsPath(target)
 	rp := s.getAbsPath(path)
 
+	tfi, err := os.Lstat(rt)
+	if err != nil {
+		return nil, err
+	}
+	// Directories can't be hard linked, and linking a symlink is surprising.
+	if !tfi.Mode().IsRegular() {
+		return nil, services.ErrObjectModeInvalid
+	}
+
+	fi, err := os.Lstat(rp)
+	if err == nil {
+		switch {
+		case os.SameFile(fi, tfi):
+			// Already linked, nothing to do.
+			return s.stat(ctx, path, pairStorageStat{})
+		case fi.Mode()&os.ModeSymlink != 0:
+			err = os.Remove(rp)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, services.ErrObjectModeInvalid
+		}
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rp), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check devices before linking to return a clear error.
+	td, err := deviceID(rt)
+	if err != nil {
+		return nil, err
+	}
+	pd, err := deviceID(filepath.Dir(rp))
+	if err != nil {
+		return nil, err
+	}
+	if td != pd {
+		return nil, fmt.Errorf("%w: %s and %s are on different devices", ErrCrossDevice, target, path)
+	}
+
+	s.invalidateMmap(rp)
+	err = os.Link(rt, rp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checksum in extended attribute is shared by the inode, only sidecar needs to be copied.
+	if s.checksumAlgorithm != "" {
+		checksum, ok, err := s.loadChecksum(rt)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			err = s.saveChecksumString(rp, checksum)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s.stat(ctx, path, pairStorageStat{})
+}
+
+func (s *Storage) createLink(ctx context.Context, path string, target string, opt pairStorageCreateLink) (o *Object, err error) {
+	if opt.HasHardLink && opt.HardLink {
+		return s.createHardLink(ctx, path, target)
+	}
+
+	mode := LinkTargetAbsolute
+	if opt.HasLinkTargetMode {
+		if err = checkLinkTargetMode(opt.LinkTargetMode); err != nil {
+			return nil, err
+		}
+		mode = opt.LinkTargetMode
+	}
+
+	rp := s.getAbsPath(path)
+	rt, err := s.formatLinkTarget(rp, target, mode)
+	if err != nil {
+		return nil, err
+	}
+
 	fi, err := os.Lstat(rp)
 	if err == nil {
 		// File exists. If the file is a symlink, then we remove it.
@@ -168,7 +500,6 @@ func (s *Storage) createLink(ctx context.Context, path string, target string, op
 	o = s.newObject(true)
 	o.ID = rp
 	o.Path = path
-	o.SetLinkTarget(rt)
 
 	o.Mode |= ModeLink
 
@@ -177,6 +508,13 @@ func (s *Storage) createLink(ctx context.Context, path string, target string, op
 		return nil, err
 	}
 
+	setObjectSystemMetadata(o, ObjectSystemMetadata{RawLinkTarget: rt})
+	// Relative targets are resolved from the dir of the link.
+	if !filepath.IsAbs(rt) {
+		rt = filepath.Join(filepath.Dir(rp), rt)
+	}
+	// Only ID exposes the physical path, the target is reported as its logical path.
+	o.SetLinkTarget(s.getLogicalPath(rt))
 	return
 }
 
@@ -210,12 +548,39 @@ func (s *Storage) fetch(ctx context.Context, path string, url string, opt pairSt
 	return nil
 }
 
+func (input *listDirInput) isHidden(name string) bool {
+	for _, v := range input.hidden {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Storage) list(ctx context.Context, path string, opt pairStorageList) (oi *ObjectIterator, err error) {
+	rp := s.getAbsDirPath(path)
+
+	if s.layout == LayoutSharded {
+		input := listShardInput{
+			rp:  rp,
+			dir: filepath.ToSlash(path),
+
+			followSymlinks:   s.isFollowSymlinks(opt.HasFollowSymlinks, opt.FollowSymlinks),
+			skipSpecialFiles: opt.HasSkipSpecialFiles && opt.SkipSpecialFiles,
+
+			continuationToken: opt.ContinuationToken,
+		}
+		if rp == s.workDir {
+			input.hidden = s.hiddenDirs
+		}
+		return NewObjectIterator(ctx, s.listShardNext, &input), nil
+	}
+
 	buf := make([]byte, 8192)
 
 	input := listDirInput{
 		// Always keep service original name as rp.
-		rp: s.getAbsPath(path),
+		rp: rp,
 		// Then convert the dir to slash separator.
 		dir: filepath.ToSlash(path),
 
@@ -224,8 +589,15 @@ func (s *Storage) list(ctx context.Context, path string, opt pairStorageList) (o
 		started:           !opt.HasContinuationToken,
 		continuationToken: opt.ContinuationToken,
 
+		followSymlinks:   s.isFollowSymlinks(opt.HasFollowSymlinks, opt.FollowSymlinks),
+		skipSpecialFiles: opt.HasSkipSpecialFiles && opt.SkipSpecialFiles,
+
 		buf: &buf,
 	}
+	// Internal dirs only exist under work dir.
+	if input.rp == s.workDir {
+		input.hidden = s.hiddenDirs
+	}
 
 	return NewObjectIterator(ctx, s.listDirNext, &input), nil
 }
@@ -262,11 +634,40 @@ func (s *Storage) move(ctx context.Context, src string, dst string, opt pairStor
 		}
 	}
 
+	// The current content is kept while rename failed.
+	_, err = s.linkVersion(rd)
+	if err != nil {
+		return err
+	}
+
+	// The replaced blob should be released after moved.
+	var sum string
+	if s.cas {
+		sum, _, err = getBlobSum(rd)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	s.invalidateMmap(rs)
+	s.invalidateMmap(rd)
+
 	err = os.Rename(rs, rd)
 	if err != nil {
 		return err
 	}
-	return
+	s.pruneShardDirs(rs)
+
+	if s.checksumAlgorithm != "" {
+		err = s.moveChecksum(rs, rd)
+		if err != nil {
+			return err
+		}
+	}
+	if sum != "" {
+		return s.releaseBlob(sum)
+	}
+	return nil
 }
 
 func (s *Storage) read(ctx context.Context, path string, w io.Writer, opt pairStorageRead) (n int64, err error) {
@@ -274,28 +675,69 @@ func (s *Storage) read(ctx context.Context, path string, w io.Writer, opt pairSt
 
 	rp := s.getAbsPath(path)
 
-	f, needClose, err := s.openFile(rp, os.O_RDONLY)
+	// Read the final target directly, so that its metadata will be used.
+	if s.isFollowSymlinks(opt.HasFollowSymlinks, opt.FollowSymlinks) && !isStdPath(rp) {
+		rp, err = s.followPath(rp)
+		if err != nil {
+			return
+		}
+	}
+
+	// Small objects could be read from mmap cache without opening.
+	if s.mmapCache != nil && !isStdPath(rp) && !(opt.HasDirectIo && opt.DirectIo) {
+		n, ok, err := s.readMmap(rp, w, opt)
+		if err != nil || ok {
+			return n, err
+		}
+	}
+
+	f, stream, err := s.openFile(rp, os.O_RDONLY)
 	if err != nil {
 		return
 	}
-	if needClose {
-		defer func() {
-			closeErr := f.Close()
-			// Only return close error while copy without error
-			if err == nil {
-				err = closeErr
-			}
-		}()
-	}
+	defer func() {
+		closeErr := closeFile(f)
+		// Only return close error while copy without error
+		if err == nil {
+			err = closeErr
+		}
+	}()
 
-	if opt.HasOffset {
-		_, err = f.Seek(opt.Offset, 0)
+	var c *objectContent
+	if !stream {
+		c, err = s.openContent(f, rp)
 		if err != nil {
+			return
+		}
+	}
+
+	sequential := opt.HasSequentialIo && opt.SequentialIo && !stream
+	if sequential {
+		// It's only a hint, the read should not fail because of it.
+		_ = adviseSequential(f)
+	}
+
+	if c != nil && c.Transformed() {
+		rc = ioutil.NopCloser(c.NewReader(opt.Offset))
+	} else if opt.HasDirectIo && opt.DirectIo && !stream {
+		dr, err := newDirectReader(f, opt.Offset)
+		if err != nil && !directIOFallback(err) {
 			return n, err
 		}
+		if dr != nil {
+			rc = ioutil.NopCloser(dr)
+		}
 	}
+	if rc == nil {
+		if opt.HasOffset {
+			_, err = f.Seek(opt.Offset, 0)
+			if err != nil {
+				return n, err
+			}
+		}
 
-	rc = f
+		rc = f
+	}
 
 	if opt.HasSize {
 		rc = iowrap.LimitReadCloser(rc, opt.Size)
@@ -304,13 +746,17 @@ func (s *Storage) read(ctx context.Context, path string, w io.Writer, opt pairSt
 		rc = iowrap.CallbackReadCloser(rc, opt.IoCallback)
 	}
 
-	return io.Copy(w, rc)
+	n, err = io.Copy(w, rc)
+	if err == nil && sequential {
+		err = dropPageCache(f, false)
+	}
+	return n, err
 }
 
 func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o *Object, err error) {
 	rp := s.getAbsPath(path)
 
-	fi, err := s.statFile(rp)
+	fi, stream, err := s.statFile(rp)
 	if err != nil {
 		return nil, err
 	}
@@ -319,11 +765,64 @@ func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o
 	o.ID = rp
 	o.Path = path
 
+	var sm ObjectSystemMetadata
+
+	// Streams could only be transferred sequentially once, their sizes are unknown.
+	if stream {
+		o.Mode |= ModeRead
+		sm.Streaming = true
+		if t, ok := specialFileType(fi.Mode()); ok {
+			sm.FileType = t
+		}
+		setObjectSystemMetadata(o, sm)
+		return o, nil
+	}
+	// fp is the file which carries the content and metadata, it's the final target
+	// while following symlinks.
+	fp := rp
+
+	// Check if this file is a link.
+	if fi.Mode()&os.ModeSymlink != 0 {
+		o.Mode |= ModeLink
+
+		sm.RawLinkTarget, err = os.Readlink(rp)
+		if err != nil {
+			return nil, err
+		}
+
+		var target string
+		if s.isFollowSymlinks(opt.HasFollowSymlinks, opt.FollowSymlinks) {
+			var tfi os.FileInfo
+			target, tfi, err = s.followSymlink(rp)
+			if err == nil {
+				fi, fp = tfi, target
+			} else if errors.Is(err, os.ErrNotExist) {
+				// Broken links are kept as links only, the same as listing.
+				target, err = evalSymlinks(rp)
+			}
+		} else {
+			target, err = evalSymlinks(rp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		o.SetLinkTarget(s.getLogicalPath(target))
+		setObjectSystemMetadata(o, sm)
+	}
+
 	if fi.IsDir() {
 		o.Mode |= ModeDir
 		return
 	}
 
+	// Special files have no content, only their types are reported.
+	if t, ok := specialFileType(fi.Mode()); ok {
+		o.SetLastModified(fi.ModTime())
+		sm.FileType = t
+		setObjectSystemMetadata(o, sm)
+		return o, nil
+	}
+
 	if fi.Mode().IsRegular() {
 		o.Mode |= ModeRead | ModePage | ModeAppend
 
@@ -333,17 +832,44 @@ func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o
 		if v := mime.DetectFilePath(path); v != "" {
 			o.SetContentType(v)
 		}
-	}
 
-	// Check if this file is a link.
-	if fi.Mode()&os.ModeSymlink != 0 {
-		o.Mode |= ModeLink
+		sm.PhysicalSize = fi.Size()
+		if v, ok := allocatedSize(fi); ok {
+			sm.AllocatedSize = v
+		}
+		if !isStdPath(fp) {
+			sm.LinkCount, err = statLinkCount(fp, fi)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if s.checksumAlgorithm != "" {
+			checksum, ok, err := s.loadChecksum(fp)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				sm.Checksum = checksum
+			}
+		}
 
-		target, err := evalSymlinks(rp)
+		c, ok, err := s.statContent(fp)
 		if err != nil {
 			return nil, err
 		}
-		o.SetLinkTarget(target)
+		if ok {
+			// ContentLength should always be the logical size.
+			o.SetContentLength(c.Size())
+			if c.idx != nil {
+				sm.Compression = c.idx.algorithm
+			}
+			if c.enc != nil {
+				sm.EncryptionKeyID = c.enc.keyID
+			}
+		}
+
+		setObjectSystemMetadata(o, sm)
 	}
 
 	return o, nil
@@ -356,33 +882,187 @@ func (s *Storage) write(ctx context.Context, path string, r io.Reader, size int6
 		return 0, fmt.Errorf("reader is nil but size is not 0")
 	}
 
-	var f io.WriteCloser
-
 	rp := s.getAbsPath(path)
+	defer s.invalidateMmap(rp)
 
-	f, needClose, err := s.createFile(rp)
+	if opt.HasIoCallback {
+		r = iowrap.CallbackReader(r, opt.IoCallback)
+	}
+
+	// Streams will never be stored as blobs or versioned.
+	if !s.isStreamPath(rp, os.O_WRONLY) {
+		if s.cas {
+			return s.writeBlob(rp, r, size, opt)
+		}
+		// Current content should only be archived after the new content has been written.
+		if s.versioning {
+			err = s.checkWriteTarget(rp)
+			if err != nil {
+				return
+			}
+			return s.writeTemp(rp, r, size, opt)
+		}
+	}
+
+	f, stream, err := s.createFile(rp)
 	if err != nil {
 		return
 	}
-	if needClose {
-		defer f.Close()
+	defer closeFile(f)
+
+	// Streams will never be encrypted or compressed.
+	if stream {
+		w, _ := s.newChecksumWriter(f)
+		return copyN(w, r, size)
+	}
+
+	n, h, err := s.writeFile(f, rp, r, size, opt)
+	if err != nil {
+		return n, err
+	}
+	if h != nil {
+		err = s.saveChecksum(rp, h)
+	}
+	return n, err
+}
+
+func (s *Storage) writeAppend(ctx context.Context, o *Object, r io.Reader, size int64, opt pairStorageWriteAppend) (n int64, err error) {
+	// Encrypted chunks can't be appended.
+	if s.encryptionKeyID != "" {
+		return 0, services.ErrCapabilityInsufficient
+	}
+	// Blobs are shared by objects and should never be modified in place.
+	if s.cas {
+		if _, ok, err := getBlobSum(o.ID); err == nil && ok {
+			return 0, services.ErrObjectModeInvalid
+		}
+	}
+	if fi, _, err := s.statFile(o.ID); err == nil && fi.Mode().IsRegular() && isSealed(o.ID, fi) {
+		return 0, ErrObjectSealed
+	}
+
+	f, stream, err := s.createFileWithFlag(o.ID, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return
 	}
+	defer closeFile(f)
 
 	if opt.HasIoCallback {
 		r = iowrap.CallbackReader(r, opt.IoCallback)
 	}
 
-	return io.CopyN(f, r, size)
-}
+	// Streams can't be locked and don't have a meaningful size, append directly.
+	if stream {
+		return io.CopyN(f, r, size)
+	}
 
-func (s *Storage) writeAppend(ctx context.Context, o *Object, r io.Reader, size int64, opt pairStorageWriteAppend) (n int64, err error) {
-	f, needClose, err := s.createFileWithFlag(o.ID, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	// Hold an exclusive lock while appending, so that concurrent appenders
+	// to the same object will not interleave. Appends are not protected on
+	// platforms without advisory locks.
+	if lockSupported {
+		err = lockFile(f, true)
+		if err != nil {
+			return
+		}
+		defer func() {
+			unlockErr := unlockFile(f)
+			if err == nil {
+				err = unlockErr
+			}
+		}()
+	}
+
+	fi, err := f.Stat()
 	if err != nil {
 		return
 	}
-	if needClose {
-		defer f.Close()
+	offset, ok := o.GetAppendOffset()
+	if !ok {
+		offset = fi.Size()
+	}
+	if offset != fi.Size() {
+		return 0, fmt.Errorf("%w: append offset is %d, but file size is %d",
+			ErrAppendOffsetMismatch, offset, fi.Size())
+	}
+
+	// The stored checksum will be outdated after appended, it will be computed again while committing.
+	if s.checksumAlgorithm != "" {
+		err = s.removeChecksum(o.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	n, err = io.CopyN(f, r, size)
+	// Keep track of the written bytes even if copy failed halfway.
+	o.SetAppendOffset(offset + n)
+	return n, err
+}
+
+// writeContent encrypts and compresses the content as configured while writing into w.
+func (s *Storage) writeContent(rp string, w io.Writer, r io.Reader, size int64) (n int64, err error) {
+	var ew *encryptWriter
+	if s.encryptionKeyID != "" {
+		ew, err = s.newEncryptWriter(w)
+		if err != nil {
+			return
+		}
+		w = ew
+	}
+
+	if s.compression != "" {
+		n, err = writeCompressed(w, r, size)
+		if err == nil {
+			err = markCompressed(rp, s.compression)
+		}
+	} else {
+		n, err = copyN(w, r, size)
+	}
+	if err == nil && ew != nil {
+		err = ew.Close()
 	}
+	return n, err
+}
 
-	return io.CopyN(f, r, size)
+// writeFile writes the content into the newly created file with I/O options, and returns
+// the checksum hash of the file if checksum is enabled.
+func (s *Storage) writeFile(f *os.File, rp string, r io.Reader, size int64, opt pairStorageWrite) (n int64, h hash.Hash, err error) {
+	preallocated := opt.HasPreallocate && opt.Preallocate && size > 0
+	if preallocated {
+		err = preallocate(f, size)
+		if err != nil {
+			return
+		}
+	}
+
+	sequential := opt.HasSequentialIo && opt.SequentialIo
+	if sequential {
+		// It's only a hint, the write should not fail because of it.
+		_ = adviseSequential(f)
+	}
+
+	var w io.Writer = f
+	var dw *directWriter
+	if opt.HasDirectIo && opt.DirectIo {
+		dw, err = newDirectWriter(f)
+		if err != nil && !directIOFallback(err) {
+			return
+		}
+		if dw != nil {
+			w = dw
+		}
+	}
+
+	w, h = s.newChecksumWriter(w)
+	n, err = s.writeContent(rp, w, r, size)
+	if err == nil && dw != nil {
+		err = dw.Close()
+	}
+	if err == nil && preallocated {
+		err = releasePreallocated(f)
+	}
+	if err == nil && sequential {
+		err = dropPageCache(f, true)
+	}
+	return n, h, err
 }
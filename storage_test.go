@@ -0,0 +1,294 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestCommitAppend(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+
+	content := []byte("hello, world")
+	n, err := s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, int64(len(content)), o.MustGetAppendOffset())
+
+	err = s.CommitAppend(o)
+	assert.NoError(t, err)
+}
+
+func TestCommitAppendOffsetMismatch(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+
+	content := []byte("hello, world")
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// Append to the file behind the storager's back.
+	f, err := os.OpenFile(o.ID, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("!"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	err = s.CommitAppend(o)
+	assert.True(t, errors.Is(err, ErrAppendOffsetMismatch))
+}
+
+func TestCommitAppendSeal(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+
+	content := []byte("hello, world")
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	err = s.CommitAppend(o, WithSealAppend())
+	assert.NoError(t, err)
+
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.True(t, errors.Is(err, ErrObjectSealed))
+
+	_, err = s.CreateAppend("append")
+	assert.True(t, errors.Is(err, ErrObjectSealed))
+
+	var buf bytes.Buffer
+	_, err = s.Read("append", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestCommitAppendReadOnly(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setXattr(s.workDir, "test", []byte("test")); errors.Is(err, errXattrUnsupported) {
+		t.Skip("read-only files are treated as sealed without extended attributes")
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+	_, err = s.WriteAppend(o, bytes.NewReader([]byte("a")), 1)
+	assert.NoError(t, err)
+
+	// Read-only files which are not sealed by commit_append should not be treated as sealed.
+	assert.NoError(t, os.Chmod(o.ID, 0444))
+	fi, err := os.Stat(o.ID)
+	assert.NoError(t, err)
+	assert.False(t, isSealed(o.ID, fi))
+
+	assert.NoError(t, os.Chmod(o.ID, 0644))
+	err = s.CommitAppend(o, WithSealAppend())
+	assert.NoError(t, err)
+	fi, err = os.Stat(o.ID)
+	assert.NoError(t, err)
+	assert.True(t, isSealed(o.ID, fi))
+}
+
+func TestWriteAppendOffsetMismatch(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+
+	content := []byte("hello, world")
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	// Another appender holds a stale offset.
+	stale := s.newObject(true)
+	stale.ID = o.ID
+	stale.Path = o.Path
+	stale.Mode = o.Mode
+	stale.SetAppendOffset(0)
+
+	_, err = s.WriteAppend(stale, bytes.NewReader(content), int64(len(content)))
+	assert.True(t, errors.Is(err, ErrAppendOffsetMismatch))
+	assert.Equal(t, int64(0), stale.MustGetAppendOffset())
+
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2*len(content)), o.MustGetAppendOffset())
+}
+
+func TestWriteAppendWithIoCallback(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.CreateAppend("append")
+	assert.NoError(t, err)
+
+	var called int64
+	content := []byte("hello, world")
+	_, err = s.WriteAppend(o, bytes.NewReader(content), int64(len(content)),
+		ps.WithIoCallback(func(b []byte) {
+			called += int64(len(b))
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), called)
+}
+
+func TestCreateHardLink(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello, world")
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	o, err := s.CreateLink("backup/a", "a", WithHardLink())
+	assert.NoError(t, err)
+	assert.False(t, o.Mode.IsLink())
+	assert.True(t, o.Mode.IsRead())
+	assert.Equal(t, uint64(2), GetObjectSystemMetadata(o).LinkCount)
+
+	// Linking again should be idempotent.
+	_, err = s.CreateLink("backup/a", "a", WithHardLink())
+	assert.NoError(t, err)
+
+	o, err = s.Stat("a")
+	assert.NoError(t, err)
+	sm := GetObjectSystemMetadata(o)
+	assert.Equal(t, uint64(2), sm.LinkCount)
+
+	o, err = s.Stat("backup/a")
+	assert.NoError(t, err)
+	assert.Equal(t, sm.Checksum, GetObjectSystemMetadata(o).Checksum)
+
+	var buf bytes.Buffer
+	_, err = s.Read("backup/a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	err = s.Delete("a")
+	assert.NoError(t, err)
+	o, err = s.Stat("backup/a")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), GetObjectSystemMetadata(o).LinkCount)
+}
+
+func TestCreateHardLinkInvalid(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.CreateLink("b", "not-exist", WithHardLink())
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+
+	_, err = s.CreateDir("dir")
+	assert.NoError(t, err)
+	_, err = s.CreateLink("b", "dir", WithHardLink())
+	assert.True(t, errors.Is(err, services.ErrObjectModeInvalid))
+
+	_, err = s.Write("a", bytes.NewReader([]byte("a")), 1)
+	assert.NoError(t, err)
+	_, err = s.Write("c", bytes.NewReader([]byte("c")), 1)
+	assert.NoError(t, err)
+	_, err = s.CreateLink("c", "a", WithHardLink())
+	assert.True(t, errors.Is(err, services.ErrObjectModeInvalid))
+}
+
+func TestCreateLinkTargetMode(t *testing.T) {
+	cases := []struct {
+		name     string
+		mode     string
+		expected string
+	}{
+		{"absolute", LinkTargetAbsolute, ""},
+		{"verbatim", LinkTargetVerbatim, filepath.FromSlash("../a")},
+		{"relative", LinkTargetRelative, filepath.Join("..", "a")},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.Write("a", bytes.NewReader([]byte("a")), 1)
+			assert.NoError(t, err)
+
+			target := "a"
+			if tt.mode == LinkTargetVerbatim {
+				target = "../a"
+			}
+			o, err := s.CreateLink("dir/b", target, WithLinkTargetMode(tt.mode))
+			assert.NoError(t, err)
+			assert.Equal(t, s.getAbsPath("a"), o.MustGetLinkTarget())
+
+			expected := tt.expected
+			if expected == "" {
+				expected = s.getAbsPath("a")
+			}
+			assert.Equal(t, expected, GetObjectSystemMetadata(o).RawLinkTarget)
+
+			o, err = s.Stat("dir/b")
+			assert.NoError(t, err)
+			assert.True(t, o.Mode.IsLink())
+			assert.Equal(t, s.getAbsPath("a"), o.MustGetLinkTarget())
+			assert.Equal(t, expected, GetObjectSystemMetadata(o).RawLinkTarget)
+		})
+	}
+}
+
+func TestCreateLinkRelativeMoved(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newStorager(ps.WithWorkDir(filepath.Join(dir, "old")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write("a", bytes.NewReader([]byte("a")), 1)
+	assert.NoError(t, err)
+	_, err = s.CreateLink("dir/b", "a", WithLinkTargetMode(LinkTargetRelative))
+	assert.NoError(t, err)
+
+	err = os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+	assert.NoError(t, err)
+
+	s, err = newStorager(ps.WithWorkDir(filepath.Join(dir, "new")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = s.Read("dir/b", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", buf.String())
+
+	_, err = s.CreateLink("c", "a", WithLinkTargetMode("invalid"))
+	assert.Error(t, err)
+}
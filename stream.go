@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fdPathPrefix is the prefix of paths which refer to inherited file descriptors.
+const fdPathPrefix = "/dev/fd/"
+
+// SpecialPathResolver resolves paths which refer to streams instead of regular files.
+//
+// Streams are read or written as is, without mode checks, truncating or seeking. flag
+// is the flag to open the path with, which tells whether the path is going to be read
+// or written.
+type SpecialPathResolver interface {
+	// Stat returns the info of the stream without opening it, ok will be false if
+	// the path is not special.
+	Stat(path string, flag int) (fi os.FileInfo, ok bool, err error)
+	// Open opens the stream, ok will be false if the path is not special.
+	//
+	// Returned files will be closed after used, except os.Stdin, os.Stdout and os.Stderr.
+	Open(path string, flag int) (f *os.File, ok bool, err error)
+}
+
+// StreamResolver is the default SpecialPathResolver.
+//
+// It resolves std streams, StdStream as stdin while reading and stdout while writing,
+// and inherited file descriptors like /dev/fd/3.
+type StreamResolver struct {
+	// FIFO opens named pipes as streams, they are refused as special files by default.
+	FIFO bool
+}
+
+// Stat implements SpecialPathResolver.
+func (r StreamResolver) Stat(path string, flag int) (fi os.FileInfo, ok bool, err error) {
+	if f, ok := stdStream(path, flag); ok {
+		fi, err = f.Stat()
+		return fi, true, err
+	}
+	if fd, ok := parseFdPath(path); ok {
+		f, err := dupFile(fd, path)
+		if err != nil {
+			return nil, true, err
+		}
+		defer f.Close()
+
+		fi, err = f.Stat()
+		return fi, true, err
+	}
+	if r.FIFO {
+		fi, err = os.Stat(path)
+		if err == nil && fi.Mode()&os.ModeNamedPipe != 0 {
+			return fi, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// Open implements SpecialPathResolver.
+func (r StreamResolver) Open(path string, flag int) (f *os.File, ok bool, err error) {
+	if f, ok := stdStream(path, flag); ok {
+		return f, true, nil
+	}
+	if fd, ok := parseFdPath(path); ok {
+		f, err = dupFile(fd, path)
+		return f, true, err
+	}
+	if _, ok, _ := r.Stat(path, flag); ok {
+		// Pipes can't be created or truncated, and opening will block until
+		// the other end has been opened.
+		f, err = os.OpenFile(path, flag&^(os.O_CREATE|os.O_EXCL|os.O_TRUNC), 0)
+		return f, true, err
+	}
+	return nil, false, nil
+}
+
+// stdStream returns the std stream which the path refers to.
+func stdStream(path string, flag int) (*os.File, bool) {
+	switch path {
+	case Stdin:
+		return os.Stdin, true
+	case Stdout:
+		return os.Stdout, true
+	case Stderr:
+		return os.Stderr, true
+	case StdStream:
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return os.Stdout, true
+		}
+		return os.Stdin, true
+	default:
+		return nil, false
+	}
+}
+
+// parseFdPath returns the file descriptor of paths like /dev/fd/3.
+func parseFdPath(path string) (int, bool) {
+	if !strings.HasPrefix(filepath.ToSlash(path), fdPathPrefix) {
+		return 0, false
+	}
+	fd, err := strconv.Atoi(path[len(fdPathPrefix):])
+	if err != nil || fd < 0 {
+		return 0, false
+	}
+	return fd, true
+}
+
+// closeFile closes the file unless it's a std stream, which is shared by the whole process.
+func closeFile(f *os.File) error {
+	if f == os.Stdin || f == os.Stdout || f == os.Stderr {
+		return nil
+	}
+	return f.Close()
+}
+
+// isStreamPath checks whether the path will be opened as a stream with flag.
+func (s *Storage) isStreamPath(absPath string, flag int) bool {
+	if isStdPath(absPath) {
+		return true
+	}
+	_, ok, _ := s.specialPathResolver.Stat(absPath, flag)
+	return ok
+}
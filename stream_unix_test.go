@@ -0,0 +1,181 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestStreamFdPath(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+
+	content := []byte("hello, world")
+	n, err := s.Write(fmt.Sprintf("/dev/fd/%d", pw.Fd()), bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	// Only the duplicated descriptor should be closed.
+	assert.NoError(t, pw.Close())
+
+	path := fmt.Sprintf("/dev/fd/%d", pr.Fd())
+	o, err := s.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, o.Mode.IsRead())
+	sm := GetObjectSystemMetadata(o)
+	assert.True(t, sm.Streaming)
+	assert.Equal(t, FileTypeFIFO, sm.FileType)
+
+	var buf bytes.Buffer
+	_, err = s.Read(path, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestStreamStdStream(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() {
+		os.Stdin, os.Stdout = stdin, stdout
+	}()
+
+	inr, inw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inr.Close()
+	outr, outw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outr.Close()
+	os.Stdin, os.Stdout = inr, outw
+
+	_, err = inw.Write([]byte("input"))
+	assert.NoError(t, err)
+	assert.NoError(t, inw.Close())
+
+	// "-" means stdin while reading.
+	var buf bytes.Buffer
+	_, err = s.Read(StdStream, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "input", buf.String())
+
+	// And stdout while writing.
+	_, err = s.Write(StdStream, bytes.NewReader([]byte("output")), 6)
+	assert.NoError(t, err)
+	assert.NoError(t, outw.Close())
+	b, err := ioutil.ReadAll(outr)
+	assert.NoError(t, err)
+	assert.Equal(t, "output", string(b))
+
+	_, err = os.Stat(s.getAbsPath(StdStream))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStreamFIFO(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithSpecialPathResolver(StreamResolver{FIFO: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := s.getAbsPath("fifo")
+	assert.NoError(t, unix.Mkfifo(fp, 0644))
+
+	o, err := s.Stat("fifo")
+	assert.NoError(t, err)
+	sm := GetObjectSystemMetadata(o)
+	assert.True(t, sm.Streaming)
+	assert.Equal(t, FileTypeFIFO, sm.FileType)
+
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadFile(fp)
+		done <- b
+	}()
+	w, err := s.NewWriter("fifo")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "hello", string(<-done))
+
+	// FIFO should be kept as is instead of being replaced.
+	fi, err := os.Lstat(fp)
+	assert.NoError(t, err)
+	assert.True(t, fi.Mode()&os.ModeNamedPipe != 0)
+
+	go func() {
+		_ = ioutil.WriteFile(fp, []byte("world"), 0644)
+	}()
+	var buf bytes.Buffer
+	_, err = s.Read("fifo", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", buf.String())
+}
+
+// pipeResolver resolves one path into the write end of a pipe.
+type pipeResolver struct {
+	StreamResolver
+
+	path string
+	f    *os.File
+}
+
+func (r pipeResolver) Stat(path string, flag int) (os.FileInfo, bool, error) {
+	if path != r.path {
+		return r.StreamResolver.Stat(path, flag)
+	}
+	fi, err := r.f.Stat()
+	return fi, true, err
+}
+
+func (r pipeResolver) Open(path string, flag int) (*os.File, bool, error) {
+	if path != r.path {
+		return r.StreamResolver.Open(path, flag)
+	}
+	return r.f, true, nil
+}
+
+func TestStreamCustomResolver(t *testing.T) {
+	dir := t.TempDir()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+
+	r := &pipeResolver{f: pw}
+	s, err := newStorager(ps.WithWorkDir(dir), WithSpecialPathResolver(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.path = s.getAbsPath("log")
+
+	// Resolved files will be closed after written.
+	_, err = s.Write("log", bytes.NewReader([]byte("hello")), 5)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(pr)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
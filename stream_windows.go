@@ -0,0 +1,12 @@
+package fs
+
+import (
+	"os"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// dupFile is not supported on windows, there is no /dev/fd.
+func dupFile(fd int, name string) (*os.File, error) {
+	return nil, &os.PathError{Op: "dup", Path: name, Err: services.ErrCapabilityInsufficient}
+}
@@ -139,7 +139,7 @@ func walkSymlinks(path string) (string, error) {
 
 		linksWalked++
 		if linksWalked > 255 {
-			return "", errors.New("EvalSymlinks: too many links")
+			return "", &os.PathError{Op: "EvalSymlinks", Path: dest, Err: syscall.ELOOP}
 		}
 
 		link, err := os.Readlink(dest)
@@ -0,0 +1,52 @@
+// lockhelper holds a lock on a path until its stdin is closed.
+//
+// It's used by the lock tests to verify contention between processes.
+//
+//	lockhelper <work_dir> <path> <exclusive|shared>
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	fs "github.com/beyondstorage/go-service-fs/v3"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "usage: lockhelper <work_dir> <path> <exclusive|shared>")
+		os.Exit(2)
+	}
+
+	store, err := fs.NewStorager(ps.WithWorkDir(os.Args[1]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s := store.(*fs.Storage)
+
+	var l io.Closer
+	if os.Args[3] == "exclusive" {
+		l, err = s.Lock(os.Args[2])
+	} else {
+		l, err = s.RLock(os.Args[2])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("locked")
+
+	// Hold the lock until our parent closes stdin.
+	_, _ = io.Copy(ioutil.Discard, os.Stdin)
+
+	err = l.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"os"
 	"testing"
 
 	fs "github.com/beyondstorage/go-service-fs/v3"
@@ -12,7 +13,13 @@ func setupTest(t *testing.T) types.Storager {
 	tmpDir := t.TempDir()
 	t.Logf("Setup test at %s", tmpDir)
 
-	store, err := fs.NewStorager(ps.WithWorkDir(tmpDir))
+	pairs := []types.Pair{ps.WithWorkDir(tmpDir)}
+	// Tests could be run in other layouts, like `sharded`.
+	if v := os.Getenv("STORAGE_FS_LAYOUT"); v != "" {
+		pairs = append(pairs, fs.WithLayout(v))
+	}
+
+	store, err := fs.NewStorager(pairs...)
 	if err != nil {
 		t.Errorf("new storager: %v", err)
 	}
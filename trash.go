@@ -0,0 +1,303 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// trashDir is the hidden dir under work dir to store deleted objects.
+//
+// Deleted object will be moved to `.trash/files/<entry_id>`, and its original path
+// and deletion time will be recorded in `.trash/info/<entry_id>`.
+const (
+	trashDir      = ".trash"
+	trashFilesDir = "files"
+	trashInfoDir  = "info"
+)
+
+// TrashEntry is an object which has been moved into trash.
+type TrashEntry struct {
+	// ID is the trash entry id.
+	ID string
+	// Path is the original path of the deleted object.
+	Path string
+	// Size is the content length of the deleted object.
+	Size int64
+	// DeletedAt is the time this object has been deleted.
+	DeletedAt time.Time
+}
+
+type trashInfo struct {
+	Path      string    `json:"path"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ListTrash will list all entries in trash, the newest comes first.
+func (s *Storage) ListTrash() (entries []TrashEntry, err error) {
+	ctx := context.Background()
+	return s.ListTrashWithContext(ctx)
+}
+
+// ListTrashWithContext will list all entries in trash, the newest comes first.
+func (s *Storage) ListTrashWithContext(ctx context.Context) (entries []TrashEntry, err error) {
+	defer func() {
+		err = s.formatError("list_trash", err)
+	}()
+
+	if !s.trash {
+		return nil, services.ErrCapabilityInsufficient
+	}
+	return s.listTrash(ctx)
+}
+
+// RestoreTrash will move the trash entry back to its original path.
+//
+// ErrObjectExist will be returned if the original path has been taken by others.
+func (s *Storage) RestoreTrash(id string) (err error) {
+	ctx := context.Background()
+	return s.RestoreTrashWithContext(ctx, id)
+}
+
+// RestoreTrashWithContext will move the trash entry back to its original path.
+//
+// ErrObjectExist will be returned if the original path has been taken by others.
+func (s *Storage) RestoreTrashWithContext(ctx context.Context, id string) (err error) {
+	defer func() {
+		err = s.formatError("restore_trash", err, id)
+	}()
+
+	if !s.trash {
+		return services.ErrCapabilityInsufficient
+	}
+	return s.restoreTrash(ctx, id)
+}
+
+// PurgeTrash will remove entries which have been deleted for longer than retention.
+//
+// Pass 0 to purge all entries.
+func (s *Storage) PurgeTrash(retention time.Duration) (n int, err error) {
+	ctx := context.Background()
+	return s.PurgeTrashWithContext(ctx, retention)
+}
+
+// PurgeTrashWithContext will remove entries which have been deleted for longer than retention.
+//
+// Pass 0 to purge all entries.
+func (s *Storage) PurgeTrashWithContext(ctx context.Context, retention time.Duration) (n int, err error) {
+	defer func() {
+		err = s.formatError("purge_trash", err)
+	}()
+
+	if !s.trash {
+		return 0, services.ErrCapabilityInsufficient
+	}
+	return s.purgeTrash(ctx, retention)
+}
+
+func (s *Storage) listTrash(ctx context.Context) (entries []TrashEntry, err error) {
+	fis, err := readDirInfos(filepath.Join(s.workDir, trashDir, trashInfoDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		if _, ok := parseTimeID(fi.Name()); !ok {
+			continue
+		}
+
+		info, err := s.readTrashInfo(fi.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		entry := TrashEntry{
+			ID:        fi.Name(),
+			Path:      info.Path,
+			DeletedAt: info.DeletedAt,
+		}
+		if ofi, err := os.Lstat(s.getTrashFilePath(fi.Name())); err == nil {
+			entry.Size = ofi.Size()
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+func (s *Storage) restoreTrash(ctx context.Context, id string) (err error) {
+	if _, ok := parseTimeID(id); !ok {
+		return fmt.Errorf("%w: invalid trash id %s", services.ErrObjectNotExist, id)
+	}
+
+	info, err := s.readTrashInfo(id)
+	if err != nil {
+		return err
+	}
+
+	rp := s.getAbsPath(info.Path)
+	if err = checkStdPath(rp); err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(rp)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrObjectExist, info.Path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rp), 0755)
+	if err != nil {
+		return err
+	}
+	s.invalidateMmap(rp)
+	err = os.Rename(s.getTrashFilePath(id), rp)
+	if err != nil {
+		return err
+	}
+	if s.checksumAlgorithm != "" {
+		err = s.moveChecksum(s.getTrashFilePath(id), rp)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(s.getTrashInfoPath(id))
+}
+
+func (s *Storage) purgeTrash(ctx context.Context, retention time.Duration) (n int, err error) {
+	entries, err := s.listTrash(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-retention)
+	for _, entry := range entries {
+		if entry.DeletedAt.After(deadline) {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+
+		err = os.Remove(s.getTrashFilePath(entry.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, err
+		}
+		if s.checksumAlgorithm != "" {
+			err = s.removeChecksum(s.getTrashFilePath(entry.ID))
+			if err != nil {
+				return n, err
+			}
+		}
+		err = os.Remove(s.getTrashInfoPath(entry.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// moveToTrash moves the object into trash, returns false if this object can't be trashed.
+//
+// Only objects inside the work dir except dirs will be trashed.
+func (s *Storage) moveToTrash(rp string) (ok bool, err error) {
+	if !s.trash {
+		return false, nil
+	}
+
+	fi, err := os.Lstat(rp)
+	if err != nil {
+		return false, err
+	}
+	if fi.IsDir() {
+		return false, nil
+	}
+
+	if _, ok := s.getWorkDirRel(rp); !ok {
+		return false, nil
+	}
+
+	for _, dir := range []string{trashFilesDir, trashInfoDir} {
+		err = os.MkdirAll(filepath.Join(s.workDir, trashDir, dir), 0755)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	now := time.Now()
+	content, err := json.Marshal(trashInfo{
+		Path:      s.relPath(rp),
+		DeletedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Create the info file exclusively to take the entry id.
+	var id string
+	var f *os.File
+	for {
+		id = formatTimeID(now)
+		f, err = os.OpenFile(s.getTrashInfoPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			now = now.Add(time.Nanosecond)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		break
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(rp, s.getTrashFilePath(id))
+	}
+	if err != nil {
+		_ = os.Remove(s.getTrashInfoPath(id))
+		return false, err
+	}
+
+	// Checksum sidecar is kept along with the trashed file, so that it will not be
+	// inherited by the object written to the same path later.
+	if s.checksumAlgorithm != "" {
+		return true, s.moveChecksum(rp, s.getTrashFilePath(id))
+	}
+	return true, nil
+}
+
+func (s *Storage) readTrashInfo(id string) (info trashInfo, err error) {
+	content, err := ioutil.ReadFile(s.getTrashInfoPath(id))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &info)
+	return
+}
+
+func (s *Storage) getTrashFilePath(id string) string {
+	return filepath.Join(s.workDir, trashDir, trashFilesDir, id)
+}
+
+func (s *Storage) getTrashInfoPath(id string) string {
+	return filepath.Join(s.workDir, trashDir, trashInfoDir, id)
+}
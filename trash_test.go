@@ -0,0 +1,145 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestTrash(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithTrash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello")
+	_, err = s.Write("dir/a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	err = s.Delete("dir/a")
+	assert.NoError(t, err)
+	_, err = s.Stat("dir/a")
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+
+	// Delete should still be idempotent.
+	err = s.Delete("dir/a")
+	assert.NoError(t, err)
+
+	// Trash should never be listed.
+	it, err := s.List("")
+	assert.NoError(t, err)
+	for {
+		o, err := it.Next()
+		if err == types.IterateDone {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "dir", o.Path)
+	}
+
+	entries, err := s.ListTrash()
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	assert.Equal(t, "dir/a", entries[0].Path)
+	assert.Equal(t, int64(len(content)), entries[0].Size)
+
+	// Restore should not overwrite the existing object.
+	_, err = s.Write("dir/a", bytes.NewReader(content), 1)
+	assert.NoError(t, err)
+	err = s.RestoreTrash(entries[0].ID)
+	assert.True(t, errors.Is(err, ErrObjectExist))
+
+	err = s.Delete("dir/a")
+	assert.NoError(t, err)
+	err = s.RestoreTrash(entries[0].ID)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = s.Read("dir/a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// The second deleted one is left.
+	entries, err = s.ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithTrash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"a", "b"} {
+		_, err = s.Write(p, nil, 0)
+		assert.NoError(t, err)
+		err = s.Delete(p)
+		assert.NoError(t, err)
+	}
+
+	n, err := s.PurgeTrash(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = s.PurgeTrash(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	entries, err := s.ListTrash()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestTrashChecksum(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithTrash(), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("a", bytes.NewReader([]byte("a")), 1)
+	assert.NoError(t, err)
+
+	// Sidecars are used while extended attributes are not supported.
+	rp := s.getAbsPath("a")
+	sp, _ := s.getChecksumSidecarPath(rp)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(sp), 0755))
+	assert.NoError(t, ioutil.WriteFile(sp, []byte("checksum"), 0644))
+
+	// Sidecar should be trashed along with the object.
+	assert.NoError(t, s.Delete("a"))
+	_, err = os.Stat(sp)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	entries, err := s.ListTrash()
+	assert.NoError(t, err)
+	assert.NoError(t, s.RestoreTrash(entries[0].ID))
+	content, err := ioutil.ReadFile(sp)
+	assert.NoError(t, err)
+	assert.Equal(t, "checksum", string(content))
+
+	// Sidecar should be purged along with the trashed object.
+	assert.NoError(t, s.Delete("a"))
+	entries, err = s.ListTrash()
+	assert.NoError(t, err)
+	tp, _ := s.getChecksumSidecarPath(s.getTrashFilePath(entries[0].ID))
+	_, err = os.Stat(tp)
+	assert.NoError(t, err)
+
+	_, err = s.PurgeTrash(0)
+	assert.NoError(t, err)
+	_, err = os.Stat(tp)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
@@ -1,10 +1,15 @@
 package fs
 
 import (
+	"crypto/cipher"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/beyondstorage/go-storage/v4/services"
 	typ "github.com/beyondstorage/go-storage/v4/types"
@@ -15,12 +20,41 @@ const (
 	Stdin  = "/dev/stdin"
 	Stdout = "/dev/stdout"
 	Stderr = "/dev/stderr"
+
+	// StdStream means stdin while reading and stdout while writing.
+	StdStream = "-"
 )
 
 // Storage is the fs client.
 type Storage struct {
 	// options for this storager.
-	workDir string // workDir dir for all operation.
+	workDir    string // workDir dir for all operation.
+	versioning bool   // keep previous versions in versionsDir.
+	trash      bool   // move deleted objects into trashDir.
+	cas        bool   // store objects as hard links to blobs in blobsDir.
+	layout     string // layout of objects under workDir.
+
+	followSymlinks  bool // follow symlinks in stat, read and list by default.
+	hiddenTempFiles bool // keep temporary files in tmpDir.
+
+	// specialPathResolver opens paths which refer to streams.
+	specialPathResolver SpecialPathResolver
+
+	checksumAlgorithm string // compute and store checksum while writing.
+	compression       string // store objects compressed.
+
+	// encryptionKeyID is the key to encrypt new objects, empty means encryption is disabled.
+	encryptionKeyID string
+	// encryptionKeys are all known keys indexed by key id.
+	encryptionKeys map[string]cipher.AEAD
+	// allowPlaintext allows reading objects which are not encrypted while encryption is enabled.
+	allowPlaintext bool
+
+	// hiddenDirs are the internal dirs under workDir which should not be listed.
+	hiddenDirs []string
+
+	// mmapCache caches small objects for reading, nil means disabled.
+	mmapCache *mmapCache
 
 	defaultPairs DefaultStoragePairs
 	features     StorageFeatures
@@ -58,6 +92,9 @@ func newStorager(pairs ...typ.Pair) (store *Storage, err error) {
 
 	store = &Storage{
 		workDir: "/",
+		layout:  LayoutFlat,
+
+		specialPathResolver: StreamResolver{},
 	}
 
 	if opt.HasDefaultStoragePairs {
@@ -66,6 +103,73 @@ func newStorager(pairs ...typ.Pair) (store *Storage, err error) {
 	if opt.HasStorageFeatures {
 		store.features = opt.StorageFeatures
 	}
+	if opt.HasVersioning && opt.Versioning {
+		store.versioning = true
+		store.hiddenDirs = append(store.hiddenDirs, versionsDir)
+	}
+	if opt.HasChecksumAlgorithm {
+		if _, err = newChecksumHash(opt.ChecksumAlgorithm); err != nil {
+			return nil, err
+		}
+		store.checksumAlgorithm = opt.ChecksumAlgorithm
+		store.hiddenDirs = append(store.hiddenDirs, checksumsDir)
+	}
+	if opt.HasCompression {
+		if err = checkCompression(opt.Compression); err != nil {
+			return nil, err
+		}
+		store.compression = opt.Compression
+	}
+	if opt.HasDecryptionKeys {
+		for id, key := range opt.DecryptionKeys {
+			if err = store.addEncryptionKey(id, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opt.HasAllowPlaintext {
+		store.allowPlaintext = opt.AllowPlaintext
+	}
+	if opt.HasEncryptionKey {
+		store.encryptionKeyID = defaultEncryptionKeyID
+		if opt.HasEncryptionKeyID {
+			store.encryptionKeyID = opt.EncryptionKeyID
+		}
+		if err = store.addEncryptionKey(store.encryptionKeyID, opt.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	if opt.HasCas && opt.Cas {
+		store.cas = true
+		store.hiddenDirs = append(store.hiddenDirs, blobsDir)
+	}
+	if opt.HasLayout {
+		if err = checkLayout(opt.Layout); err != nil {
+			return nil, err
+		}
+		store.layout = opt.Layout
+	}
+	if opt.HasSpecialPathResolver {
+		store.specialPathResolver = opt.SpecialPathResolver
+	}
+	if opt.HasFollowSymlinks {
+		store.followSymlinks = opt.FollowSymlinks
+	}
+	if opt.HasMmapCacheCapacity && opt.MmapCacheCapacity > 0 && mmapSupported {
+		maxSize := int64(mmapCacheDefaultMaxSize)
+		if opt.HasMmapCacheMaxSize {
+			maxSize = opt.MmapCacheMaxSize
+		}
+		store.mmapCache = newMmapCache(opt.MmapCacheCapacity, maxSize)
+	}
+	if opt.HasHiddenTempFiles && opt.HiddenTempFiles {
+		store.hiddenTempFiles = true
+		store.hiddenDirs = append(store.hiddenDirs, tmpDir)
+	}
+	if opt.HasTrash && opt.Trash {
+		store.trash = true
+		store.hiddenDirs = append(store.hiddenDirs, trashDir)
+	}
 	if opt.HasWorkDir {
 		workDir, err := evalSymlinks(opt.WorkDir)
 		if err != nil {
@@ -79,20 +183,46 @@ func newStorager(pairs ...typ.Pair) (store *Storage, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if store.cas {
+		err = checkCasSupported(store.workDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Temporary files left by crashed writes are not visible, sweep them while starting.
+	if store.hiddenTempFiles {
+		err = store.sweepTempFiles()
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
 func formatError(err error) error {
-	if _, ok := err.(services.InternalError); ok {
+	var ie services.InternalError
+	if errors.As(err, &ie) {
 		return err
 	}
 
+	// Handle errno returned by syscalls.
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		for _, v := range errnoErrors {
+			if v.errno == errno {
+				return fmt.Errorf("%w: %v", v.err, err)
+			}
+		}
+	}
+
 	// Handle error returned by os package.
 	switch {
 	case errors.Is(err, os.ErrNotExist):
 		return fmt.Errorf("%w: %v", services.ErrObjectNotExist, err)
 	case errors.Is(err, os.ErrPermission):
 		return fmt.Errorf("%w: %v", services.ErrPermissionDenied, err)
+	case errors.Is(err, os.ErrExist):
+		return fmt.Errorf("%w: %v", ErrObjectExist, err)
 	default:
 		return fmt.Errorf("%w: %v", services.ErrUnexpected, err)
 	}
@@ -102,36 +232,36 @@ func (s *Storage) newObject(done bool) *typ.Object {
 	return typ.NewObject(s, done)
 }
 
-func (s *Storage) openFile(absPath string, mode int) (f *os.File, needClose bool, err error) {
-	switch absPath {
-	case Stdin:
-		f = os.Stdin
-	case Stdout:
-		f = os.Stdout
-	case Stderr:
-		f = os.Stderr
-	default:
-		needClose = true
-		f, err = os.OpenFile(absPath, mode, 0664)
+// openFile opens the file, stream will be true if the path has been resolved as a stream.
+//
+// The file should be closed by closeFile, std streams will be kept open.
+func (s *Storage) openFile(absPath string, mode int) (f *os.File, stream bool, err error) {
+	f, stream, err = s.specialPathResolver.Open(absPath, mode)
+	if err != nil || stream {
+		return
 	}
 
+	if err = checkSpecialFile(absPath); err != nil {
+		return
+	}
+	f, err = os.OpenFile(absPath, mode, 0664)
 	return
 }
 
-func (s *Storage) createFile(absPath string) (f *os.File, needClose bool, err error) {
+func (s *Storage) createFile(absPath string) (f *os.File, stream bool, err error) {
 	return s.createFileWithFlag(absPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
 }
 
-func (s *Storage) createFileWithFlag(absPath string, flag int) (f *os.File, needClose bool, err error) {
-	switch absPath {
-	case Stdin:
-		return os.Stdin, false, nil
-	case Stdout:
-		return os.Stdout, false, nil
-	case Stderr:
-		return os.Stderr, false, nil
+func (s *Storage) createFileWithFlag(absPath string, flag int) (f *os.File, stream bool, err error) {
+	// Streams are written as is, without mode checks or truncating.
+	f, stream, err = s.specialPathResolver.Open(absPath, flag)
+	if err != nil || stream {
+		return
 	}
 
+	// The file will be modified in place, cached mapping must not be used anymore.
+	s.invalidateMmap(absPath)
+
 	fi, err := os.Lstat(absPath)
 	if err == nil {
 		// File is exist, let's check if the file is a dir or a symlink.
@@ -161,35 +291,97 @@ func (s *Storage) createFileWithFlag(absPath string, flag int) (f *os.File, need
 	if err != nil {
 		return nil, false, err
 	}
-	return f, true, nil
+	return f, false, nil
 }
 
-func (s *Storage) statFile(absPath string) (fi os.FileInfo, err error) {
+// isStdPath checks whether the path refers to std streams or inherited file descriptors.
+func isStdPath(absPath string) bool {
 	switch absPath {
-	case Stdin:
-		fi, err = os.Stdin.Stat()
-	case Stdout:
-		fi, err = os.Stdout.Stat()
-	case Stderr:
-		fi, err = os.Stderr.Stat()
-	default:
-		// Use Lstat here to not follow symlinks.
-		// We will resolve symlinks target while this object's type is link.
-		fi, err = os.Lstat(absPath)
+	case Stdin, Stdout, Stderr, StdStream:
+		return true
+	}
+	_, ok := parseFdPath(absPath)
+	return ok
+}
+
+// checkStdPath refuses std streams in operations which only work on files under work dir.
+func checkStdPath(absPath string) error {
+	if isStdPath(absPath) {
+		return fmt.Errorf("%w: %s is a std stream", services.ErrCapabilityInsufficient, absPath)
 	}
+	return nil
+}
 
+// statFile returns the info of the file, stream will be true if the path has been
+// resolved as a stream.
+func (s *Storage) statFile(absPath string) (fi os.FileInfo, stream bool, err error) {
+	fi, stream, err = s.specialPathResolver.Stat(absPath, os.O_RDONLY)
+	if err != nil || stream {
+		return
+	}
+
+	// Use Lstat here to not follow symlinks.
+	// We will resolve symlinks target while this object's type is link.
+	fi, err = os.Lstat(absPath)
 	return
 }
 
+// isHiddenPath checks whether this path is inside the internal hidden dirs.
+func (s *Storage) isHiddenPath(absPath string) bool {
+	for _, name := range s.hiddenDirs {
+		dir := filepath.Join(s.workDir, name)
+		if absPath == dir || strings.HasPrefix(absPath, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getWorkDirRel returns the path relative to work dir, returns false if
+// the path is the work dir itself or outside of the work dir.
+func (s *Storage) getWorkDirRel(absPath string) (string, bool) {
+	rel, err := filepath.Rel(s.workDir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// sealXattr is the extended attribute to mark the file sealed by commit_append.
+const sealXattr = "sealed"
+
+// isSealed checks whether this file has been sealed by commit_append.
+//
+// Seal is recorded in extended attribute, read-only files will be treated as sealed
+// only while extended attributes are not supported.
+func isSealed(path string, fi os.FileInfo) bool {
+	_, err := getXattr(path, sealXattr)
+	if errors.Is(err, errXattrUnsupported) {
+		return fi.Mode().Perm()&0222 == 0
+	}
+	return err == nil
+}
+
 func (s *Storage) getAbsPath(path string) string {
-	if filepath.IsAbs(path) {
+	if filepath.IsAbs(path) || path == StdStream {
 		return path
 	}
 	absPath := filepath.Join(s.workDir, path)
 
+	if s.layout == LayoutSharded {
+		return s.getShardedPath(absPath)
+	}
 	return absPath
 }
 
+// getAbsDirPath returns the absolute path of the dir, dirs are never sharded.
+func (s *Storage) getAbsDirPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.workDir, path)
+}
+
 func (s *Storage) formatError(op string, err error, path ...string) error {
 	if err == nil {
 		return nil
@@ -202,3 +394,65 @@ func (s *Storage) formatError(op string, err error, path ...string) error {
 		Path:     path,
 	}
 }
+
+// formatTimeID formats time into a fixed width id, so that ids can be sorted directly.
+func formatTimeID(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// parseTimeID parses the id generated by formatTimeID.
+func parseTimeID(id string) (time.Time, bool) {
+	if len(id) != 20 {
+		return time.Time{}, false
+	}
+	var ns int64
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return time.Time{}, false
+		}
+		ns = ns*10 + int64(c-'0')
+	}
+	return time.Unix(0, ns), true
+}
+
+// copyN copies size bytes from r to w, or all content until EOF if size is -1.
+func copyN(w io.Writer, r io.Reader, size int64) (n int64, err error) {
+	if size < 0 {
+		return io.Copy(w, r)
+	}
+	return io.CopyN(w, r, size)
+}
+
+// copyFile copies the content of src into a new created dst.
+func copyFile(src, dst string, perm os.FileMode) (err error) {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := df.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = copySparse(df, sf, nil)
+	return err
+}
+
+// readDirInfos reads all entries in the dir.
+func readDirInfos(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdir(-1)
+}
@@ -1,10 +1,16 @@
 package fs
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
 	"github.com/beyondstorage/go-storage/v4/services"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,6 +33,11 @@ func TestFormatOsError(t *testing.T) {
 			os.ErrNotExist,
 			services.ErrObjectNotExist,
 		},
+		{
+			"no space",
+			&os.PathError{Op: "fallocate", Path: "a", Err: syscall.ENOSPC},
+			ErrInsufficientStorage,
+		},
 		{
 			"not supported error",
 			testErr,
@@ -42,6 +53,17 @@ func TestFormatOsError(t *testing.T) {
 	}
 }
 
+func TestFormatErrnoError(t *testing.T) {
+	for _, tt := range errnoErrors {
+		t.Run(tt.errno.Error(), func(t *testing.T) {
+			err := formatError(&os.PathError{Op: "test", Path: "a", Err: tt.errno})
+			assert.True(t, errors.Is(err, tt.err))
+			// The original errno should be kept in message.
+			assert.Contains(t, err.Error(), tt.errno.Error())
+		})
+	}
+}
+
 func BenchmarkStorage_getAbsPath(b *testing.B) {
 	store := &Storage{
 		workDir: "/abc/def",
@@ -53,3 +75,64 @@ func BenchmarkStorage_getAbsPath(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestStdPathRefused(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithVersioning(), WithChecksumAlgorithm(ChecksumSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Std streams should never be resolved as files in the current dir.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(wd)
+	}()
+
+	versionID := formatTimeID(time.Now())
+	fns := map[string]func() error{
+		"open": func() error {
+			_, err := s.Open(StdStream)
+			return err
+		},
+		"read_ranges": func() error {
+			_, err := s.ReadRanges(StdStream, []Range{{Offset: 0, Size: 1}}, []io.Writer{&bytes.Buffer{}})
+			return err
+		},
+		"lock": func() error {
+			_, err := s.Lock(StdStream)
+			return err
+		},
+		"list_versions": func() error {
+			_, err := s.ListVersions(StdStream)
+			return err
+		},
+		"read_version": func() error {
+			_, err := s.ReadVersion(StdStream, versionID, &bytes.Buffer{})
+			return err
+		},
+		"restore_version": func() error {
+			return s.RestoreVersion(StdStream, versionID)
+		},
+		"truncate": func() error {
+			return s.Truncate(StdStream, 0)
+		},
+		"scrub": func() error {
+			_, err := s.Scrub(Stdin)
+			return err
+		},
+	}
+	for name, fn := range fns {
+		err = fn()
+		assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient), "%s: %v", name, err)
+	}
+
+	fis, err := ioutil.ReadDir(".")
+	assert.NoError(t, err)
+	assert.Len(t, fis, 0)
+}
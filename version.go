@@ -0,0 +1,308 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// versionsDir is the hidden dir under work dir to store previous versions.
+//
+// Version of object `a/b` will be stored as `.versions/a/b/<version_id>`.
+const versionsDir = ".versions"
+
+// ObjectVersion is a previous version of an object.
+type ObjectVersion struct {
+	// ID is the version id, version ids of the same object are sortable by time.
+	ID string
+	// Path is the object path this version belongs to.
+	Path string
+	// Size is the content length of this version.
+	Size int64
+	// ArchivedAt is the time this version has been replaced or deleted.
+	ArchivedAt time.Time
+}
+
+// ListVersions will list all previous versions of the object, the newest comes first.
+func (s *Storage) ListVersions(path string) (versions []ObjectVersion, err error) {
+	ctx := context.Background()
+	return s.ListVersionsWithContext(ctx, path)
+}
+
+// ListVersionsWithContext will list all previous versions of the object, the newest comes first.
+func (s *Storage) ListVersionsWithContext(ctx context.Context, path string) (versions []ObjectVersion, err error) {
+	defer func() {
+		err = s.formatError("list_versions", err, path)
+	}()
+
+	if !s.versioning {
+		return nil, services.ErrCapabilityInsufficient
+	}
+	return s.listVersions(ctx, path)
+}
+
+// ReadVersion will read the content of the specified version.
+//
+// ReadVersion supports the same pairs as Read.
+func (s *Storage) ReadVersion(path, versionID string, w io.Writer, pairs ...Pair) (n int64, err error) {
+	ctx := context.Background()
+	return s.ReadVersionWithContext(ctx, path, versionID, w, pairs...)
+}
+
+// ReadVersionWithContext will read the content of the specified version.
+//
+// ReadVersionWithContext supports the same pairs as ReadWithContext.
+func (s *Storage) ReadVersionWithContext(ctx context.Context, path, versionID string, w io.Writer, pairs ...Pair) (n int64, err error) {
+	defer func() {
+		err = s.formatError("read_version", err, path, versionID)
+	}()
+
+	if !s.versioning {
+		return 0, services.ErrCapabilityInsufficient
+	}
+
+	pairs = append(pairs, s.defaultPairs.Read...)
+	opt, err := s.parsePairStorageRead(pairs)
+	if err != nil {
+		return
+	}
+
+	vp, err := s.getVersionPath(path, versionID)
+	if err != nil {
+		return
+	}
+	return s.read(ctx, vp, w, opt)
+}
+
+// RestoreVersion will restore the object to the specified version.
+//
+// The current content of the object will be kept as a new version.
+func (s *Storage) RestoreVersion(path, versionID string) (err error) {
+	ctx := context.Background()
+	return s.RestoreVersionWithContext(ctx, path, versionID)
+}
+
+// RestoreVersionWithContext will restore the object to the specified version.
+//
+// The current content of the object will be kept as a new version.
+func (s *Storage) RestoreVersionWithContext(ctx context.Context, path, versionID string) (err error) {
+	defer func() {
+		err = s.formatError("restore_version", err, path, versionID)
+	}()
+
+	if !s.versioning {
+		return services.ErrCapabilityInsufficient
+	}
+	return s.restoreVersion(ctx, path, versionID)
+}
+
+func (s *Storage) listVersions(ctx context.Context, path string) (versions []ObjectVersion, err error) {
+	rp := s.getAbsPath(path)
+	if err = checkStdPath(rp); err != nil {
+		return nil, err
+	}
+
+	dir, ok := s.getVersionDir(rp)
+	if !ok {
+		return nil, services.ErrObjectNotExist
+	}
+
+	fis, err := readDirInfos(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		at, ok := parseTimeID(fi.Name())
+		if !ok {
+			continue
+		}
+		versions = append(versions, ObjectVersion{
+			ID:         fi.Name(),
+			Path:       filepath.ToSlash(path),
+			Size:       fi.Size(),
+			ArchivedAt: at,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+func (s *Storage) restoreVersion(ctx context.Context, path, versionID string) (err error) {
+	vp, err := s.getVersionPath(path, versionID)
+	if err != nil {
+		return
+	}
+
+	src, err := os.Open(vp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Std streams have been refused by getVersionPath.
+	rp := s.getAbsPath(path)
+	err = s.checkWriteTarget(rp)
+	if err != nil {
+		return err
+	}
+
+	// Always copy the content back, restored object could be appended later
+	// which should not touch the stored version.
+	dst, err := s.createTempFile(rp)
+	if err != nil {
+		return err
+	}
+	tmp := dst.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	_, err = io.CopyBuffer(dst, src, make([]byte, 1024*1024))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return s.replaceFile(tmp, rp)
+}
+
+// archiveVersion moves the current content of the file into versions dir,
+// the file will not exist anymore after archived.
+//
+// Only use it while the file is going to be removed, content which will replace
+// the file should be written into a temporary file and published by replaceFile,
+// so that the file is kept if the write failed.
+func (s *Storage) archiveVersion(rp string) (err error) {
+	ok, err := s.linkVersion(rp)
+	if err != nil || !ok {
+		return err
+	}
+	// Remove the file so that the archived inode will not be modified by later writes.
+	return os.Remove(rp)
+}
+
+// replaceFile archives the current content of rp, and replaces it with tmp atomically.
+func (s *Storage) replaceFile(tmp, rp string) (err error) {
+	// The replaced blob should be released after replaced.
+	var sum string
+	if s.cas {
+		sum, _, err = getBlobSum(rp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// The archived inode is kept intact, because rename replaces the entry only.
+	_, err = s.linkVersion(rp)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateMmap(rp)
+	err = os.Rename(tmp, rp)
+	if err != nil {
+		return err
+	}
+
+	if sum != "" {
+		return s.releaseBlob(sum)
+	}
+	return nil
+}
+
+// linkVersion stores the current content of the file into versions dir, and
+// returns false if nothing has been archived.
+//
+// Hard link will be used to avoid copying data, and fallback to copy if not supported.
+// Only regular files inside the work dir will be archived.
+func (s *Storage) linkVersion(rp string) (ok bool, err error) {
+	if !s.versioning {
+		return false, nil
+	}
+
+	fi, err := os.Lstat(rp)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !fi.Mode().IsRegular() {
+		return false, nil
+	}
+
+	dir, ok := s.getVersionDir(rp)
+	if !ok {
+		return false, nil
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for {
+		vp := filepath.Join(dir, formatTimeID(now))
+
+		err = os.Link(rp, vp)
+		if errors.Is(err, os.ErrExist) {
+			// Version id conflicts, try next one.
+			now = now.Add(time.Nanosecond)
+			continue
+		}
+		if err != nil {
+			err = copyFile(rp, vp, fi.Mode().Perm())
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// getVersionDir returns the dir which stores all versions of this file.
+func (s *Storage) getVersionDir(rp string) (string, bool) {
+	rel, ok := s.getWorkDirRel(rp)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(s.workDir, versionsDir, rel), true
+}
+
+func (s *Storage) getVersionPath(path, versionID string) (string, error) {
+	if _, ok := parseTimeID(versionID); !ok {
+		return "", fmt.Errorf("%w: invalid version id %s", services.ErrObjectNotExist, versionID)
+	}
+
+	rp := s.getAbsPath(path)
+	if err := checkStdPath(rp); err != nil {
+		return "", err
+	}
+
+	dir, ok := s.getVersionDir(rp)
+	if !ok {
+		return "", services.ErrObjectNotExist
+	}
+	return filepath.Join(dir, versionID), nil
+}
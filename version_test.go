@@ -0,0 +1,140 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestVersioning(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"v1", "v2", "v3"} {
+		_, err = s.Write("a", bytes.NewReader([]byte(v)), int64(len(v)))
+		assert.NoError(t, err)
+	}
+
+	versions, err := s.ListVersions("a")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	// The newest version comes first.
+	var buf bytes.Buffer
+	_, err = s.ReadVersion("a", versions[0].ID, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", buf.String())
+
+	buf.Reset()
+	_, err = s.ReadVersion("a", versions[1].ID, &buf, ps.WithOffset(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", buf.String())
+
+	err = s.RestoreVersion("a", versions[1].ID)
+	assert.NoError(t, err)
+
+	buf.Reset()
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", buf.String())
+
+	// Content before restore should be kept as a new version.
+	versions, err = s.ListVersions("a")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+
+	err = s.Delete("a")
+	assert.NoError(t, err)
+	versions, err = s.ListVersions("a")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	// Versions should never be listed.
+	it, err := s.List("")
+	assert.NoError(t, err)
+	for {
+		o, err := it.Next()
+		if err == types.IterateDone {
+			break
+		}
+		assert.NoError(t, err)
+		t.Errorf("unexpected object %s", o.Path)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestVersioningFailedWrite(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Write("a", bytes.NewReader([]byte("v1")), 2)
+	assert.NoError(t, err)
+
+	// The current content should be kept if the write failed partway.
+	r := io.MultiReader(bytes.NewReader([]byte("partial")), errReader{})
+	_, err = s.Write("a", r, 100)
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", buf.String())
+
+	versions, err := s.ListVersions("a")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 0)
+}
+
+func TestVersioningCopyAndMove(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"a", "b", "c"} {
+		_, err = s.Write(p, bytes.NewReader([]byte(p)), 1)
+		assert.NoError(t, err)
+	}
+
+	err = s.Copy("a", "b")
+	assert.NoError(t, err)
+	err = s.Move("a", "c")
+	assert.NoError(t, err)
+
+	for _, p := range []string{"b", "c"} {
+		versions, err := s.ListVersions(p)
+		assert.NoError(t, err)
+		if assert.Len(t, versions, 1) {
+			var buf bytes.Buffer
+			_, err = s.ReadVersion(p, versions[0].ID, &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, p, buf.String())
+		}
+	}
+}
+
+func TestVersioningDisabled(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.ListVersions("a")
+	assert.True(t, errors.Is(err, services.ErrCapabilityInsufficient))
+}
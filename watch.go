@@ -0,0 +1,374 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+const (
+	watchEventBufferSize = 128
+	watchDefaultInterval = 2 * time.Second
+)
+
+// WatchOp is the operation happened on a watched path.
+type WatchOp uint8
+
+const (
+	// WatchCreate means a file or dir has been created.
+	WatchCreate WatchOp = iota + 1
+	// WatchWrite means a file has been written and closed.
+	WatchWrite
+	// WatchDelete means a file or dir has been deleted.
+	WatchDelete
+	// WatchMove means a file or dir has been moved.
+	//
+	// OldPath will be empty if it's moved from outside of the watched tree,
+	// and Path will be empty if it's moved to outside of the watched tree.
+	// Moves are only reported by inotify, polling reports them as deletes and creates.
+	WatchMove
+	// WatchRescan means some events have been dropped, for example the event queue
+	// has overflowed. Consumers should rescan the watched path to sync their state.
+	WatchRescan
+)
+
+// String implements Stringer.
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreate:
+		return "create"
+	case WatchWrite:
+		return "write"
+	case WatchDelete:
+		return "delete"
+	case WatchMove:
+		return "move"
+	case WatchRescan:
+		return "rescan"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent is the event emitted by Watcher.
+type WatchEvent struct {
+	Op WatchOp
+	// Path is slash separated and relative to the work dir.
+	Path string
+	// OldPath is only set for WatchMove.
+	OldPath string
+	// IsDir will be true if the event happened on a dir.
+	IsDir bool
+}
+
+// Watcher watches changes under a dir.
+type Watcher struct {
+	events  chan WatchEvent
+	done    chan struct{}
+	stopped chan struct{}
+
+	closeOnce sync.Once
+	closeFn   func() error
+	wg        sync.WaitGroup
+
+	err error
+}
+
+func newWatcher() *Watcher {
+	return &Watcher{
+		events:  make(chan WatchEvent, watchEventBufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Events returns the channel of watch events.
+//
+// The channel will be closed after the watcher has been closed or failed, check Err for the reason.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Err returns the error which stopped the watcher.
+//
+// Err should only be called after the Events channel has been closed.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops the watcher and waits for the Events channel to be closed.
+func (w *Watcher) Close() (err error) {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		if w.closeFn != nil {
+			err = w.closeFn()
+		}
+		// Drain events so that the worker will not be blocked.
+		go func() {
+			for range w.events {
+			}
+		}()
+		w.wg.Wait()
+	})
+	return err
+}
+
+// run starts fn in a worker goroutine, the Events channel will be closed after fn returned.
+func (w *Watcher) run(ctx context.Context, fn func() error) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(w.stopped)
+		defer close(w.events)
+
+		w.err = fn()
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = w.Close()
+		case <-w.done:
+		case <-w.stopped:
+		}
+	}()
+}
+
+// emit sends event to consumer, returns false if the watcher has been closed.
+func (w *Watcher) emit(ev WatchEvent) bool {
+	select {
+	case w.events <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// Watch will watch the changes under the dir.
+//
+// Watch is built on inotify on Linux, and falls back to polling on other platforms.
+// Polling never reports moves, they are reported as deletes and creates instead.
+// The watcher must be closed after used.
+func (s *Storage) Watch(path string, pairs ...Pair) (w *Watcher, err error) {
+	ctx := context.Background()
+	return s.WatchWithContext(ctx, path, pairs...)
+}
+
+// WatchWithContext will watch the changes under the dir.
+//
+// The watcher will be closed after the context is done.
+func (s *Storage) WatchWithContext(ctx context.Context, path string, pairs ...Pair) (w *Watcher, err error) {
+	defer func() {
+		err = s.formatError("watch", err, path)
+	}()
+
+	opt, err := s.parsePairStorageWatch(pairs)
+	if err != nil {
+		return
+	}
+	return s.watch(ctx, path, opt)
+}
+
+type pairStorageWatch struct {
+	pairs []Pair
+	// Optional pairs
+	HasWatchInterval  bool
+	WatchInterval     time.Duration
+	HasWatchRecursive bool
+	WatchRecursive    bool
+}
+
+func (s *Storage) parsePairStorageWatch(opts []Pair) (pairStorageWatch, error) {
+	result := pairStorageWatch{pairs: opts}
+
+	for _, v := range opts {
+		switch v.Key {
+		case "watch_interval":
+			if result.HasWatchInterval {
+				continue
+			}
+			result.HasWatchInterval = true
+			result.WatchInterval = v.Value.(time.Duration)
+		case "watch_recursive":
+			if result.HasWatchRecursive {
+				continue
+			}
+			result.HasWatchRecursive = true
+			result.WatchRecursive = v.Value.(bool)
+		default:
+			return pairStorageWatch{}, services.PairUnsupportedError{Pair: v}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) watch(ctx context.Context, path string, opt pairStorageWatch) (w *Watcher, err error) {
+	rp := s.getAbsDirPath(path)
+
+	fi, err := os.Stat(rp)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, services.ErrObjectModeInvalid
+	}
+
+	w, err = s.newNotifyWatcher(ctx, rp, opt)
+	if err == nil {
+		return w, nil
+	}
+	if !errors.Is(err, errNotifyUnsupported) {
+		return nil, err
+	}
+	return s.newPollWatcher(ctx, rp, opt)
+}
+
+// errNotifyUnsupported means the platform notify mechanism is not available,
+// and we should fall back to polling.
+var errNotifyUnsupported = errors.New("notify unsupported")
+
+// relPath converts an absolute path into slash separated path relative to the work dir.
+func (s *Storage) relPath(absPath string) string {
+	rel, err := filepath.Rel(s.workDir, absPath)
+	if err != nil {
+		return filepath.ToSlash(absPath)
+	}
+	// Work dir itself should be represented as empty path.
+	if rel == "." {
+		return ""
+	}
+	if s.layout == LayoutSharded {
+		return getLogicalRel(filepath.ToSlash(rel))
+	}
+	return filepath.ToSlash(rel)
+}
+
+type pollEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func (s *Storage) newPollWatcher(ctx context.Context, rp string, opt pairStorageWatch) (w *Watcher, err error) {
+	interval := watchDefaultInterval
+	if opt.HasWatchInterval && opt.WatchInterval > 0 {
+		interval = opt.WatchInterval
+	}
+
+	// Take the first snapshot synchronously, so that all changes after Watch returned can be noticed.
+	prev, err := s.pollSnapshot(rp, opt.HasWatchRecursive && opt.WatchRecursive)
+	if err != nil {
+		return nil, err
+	}
+
+	w = newWatcher()
+	w.run(ctx, func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return nil
+			case <-ticker.C:
+			}
+
+			cur, err := s.pollSnapshot(rp, opt.HasWatchRecursive && opt.WatchRecursive)
+			if err != nil {
+				return err
+			}
+			for _, ev := range diffPollSnapshot(prev, cur) {
+				if !w.emit(ev) {
+					return nil
+				}
+			}
+			prev = cur
+		}
+	})
+	return w, nil
+}
+
+// pollSnapshot lists the dir and returns a map from path to entry.
+func (s *Storage) pollSnapshot(rp string, recursive bool) (m map[string]pollEntry, err error) {
+	m = make(map[string]pollEntry)
+
+	dirs := []string{rp}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		it, err := s.List(dir)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			o, err := it.Next()
+			if err == IterateDone {
+				break
+			}
+			if err != nil {
+				// The dir could be removed while listing, it will be noticed in next round.
+				if dir != rp && errors.Is(err, services.ErrObjectNotExist) {
+					break
+				}
+				return nil, err
+			}
+
+			fi, err := os.Lstat(o.ID)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+
+			m[s.relPath(o.ID)] = pollEntry{
+				isDir:   fi.IsDir(),
+				size:    fi.Size(),
+				modTime: fi.ModTime(),
+			}
+			if recursive && fi.IsDir() {
+				dirs = append(dirs, o.ID)
+			}
+		}
+	}
+	return m, nil
+}
+
+// diffPollSnapshot compares two snapshots and returns events sorted by path.
+func diffPollSnapshot(prev, cur map[string]pollEntry) []WatchEvent {
+	var events []WatchEvent
+
+	for p, c := range cur {
+		v, ok := prev[p]
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Op: WatchCreate, Path: p, IsDir: c.isDir})
+		case v.isDir != c.isDir:
+			// The path has been replaced with a different type.
+			events = append(events,
+				WatchEvent{Op: WatchDelete, Path: p, IsDir: v.isDir},
+				WatchEvent{Op: WatchCreate, Path: p, IsDir: c.isDir})
+		case !c.isDir && (v.size != c.size || !v.modTime.Equal(c.modTime)):
+			events = append(events, WatchEvent{Op: WatchWrite, Path: p})
+		}
+	}
+	for p, v := range prev {
+		if _, ok := cur[p]; !ok {
+			events = append(events, WatchEvent{Op: WatchDelete, Path: p, IsDir: v.isDir})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
@@ -0,0 +1,307 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+// inotifyMoveTimeout is the duration to wait for IN_MOVED_TO after IN_MOVED_FROM,
+// the pair could be split across reads.
+const inotifyMoveTimeout = 50 * time.Millisecond
+
+var errWatcherClosed = errors.New("watcher closed")
+
+type inotifyWatcher struct {
+	s  *Storage
+	w  *Watcher
+	fd int
+	f  *os.File
+
+	root      string
+	recursive bool
+
+	// wd -> absolute dir path
+	dirs map[int]string
+	// cookie -> absolute old path, for IN_MOVED_FROM waiting for its IN_MOVED_TO
+	moves map[uint32]inotifyMove
+}
+
+type inotifyMove struct {
+	path  string
+	isDir bool
+	// at is the time IN_MOVED_FROM has been read.
+	at time.Time
+}
+
+func (s *Storage) newNotifyWatcher(ctx context.Context, rp string, opt pairStorageWatch) (w *Watcher, err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) {
+			return nil, errNotifyUnsupported
+		}
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	iw := &inotifyWatcher{
+		s:  s,
+		w:  newWatcher(),
+		fd: fd,
+		// The fd is non-blocking, so it will be registered into runtime poller,
+		// and Close will interrupt the pending Read.
+		f: os.NewFile(uintptr(fd), "inotify"),
+
+		root:      rp,
+		recursive: opt.HasWatchRecursive && opt.WatchRecursive,
+
+		dirs:  make(map[int]string),
+		moves: make(map[uint32]inotifyMove),
+	}
+
+	err = filepath.Walk(rp, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if s.isHiddenPath(path) {
+			return filepath.SkipDir
+		}
+		// Shards are part of their parent dir, so they are always watched.
+		if path != rp && !iw.recursive && !iw.isShardPath(path) {
+			return filepath.SkipDir
+		}
+		return iw.addWatch(path)
+	})
+	if err != nil {
+		_ = iw.f.Close()
+		return nil, err
+	}
+
+	iw.w.closeFn = iw.f.Close
+	iw.w.run(ctx, iw.loop)
+	return iw.w, nil
+}
+
+func (iw *inotifyWatcher) addWatch(dir string) error {
+	wd, err := unix.InotifyAddWatch(iw.fd, dir, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	iw.dirs[wd] = dir
+	return nil
+}
+
+// addWatchTree adds watches for the new created dir and all its sub dirs.
+//
+// Files could be created before the watch has been added, so we emit create events
+// for all entries we found.
+func (iw *inotifyWatcher) addWatchTree(dir string) bool {
+	ok := true
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The dir could be removed before we walk it, just ignore.
+			return nil
+		}
+		if path != dir && !iw.isShardPath(path) &&
+			!iw.w.emit(WatchEvent{Op: WatchCreate, Path: iw.s.relPath(path), IsDir: info.IsDir()}) {
+			ok = false
+			return errWatcherClosed
+		}
+		if info.IsDir() {
+			_ = iw.addWatch(path)
+		}
+		return nil
+	})
+	return ok
+}
+
+// removeWatchTree removes watches for the dir which has been moved out.
+func (iw *inotifyWatcher) removeWatchTree(dir string) {
+	for wd, path := range iw.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			_, _ = unix.InotifyRmWatch(iw.fd, uint32(wd))
+			delete(iw.dirs, wd)
+		}
+	}
+}
+
+// renameWatchTree updates the watched dirs after a dir has been moved inside the tree.
+func (iw *inotifyWatcher) renameWatchTree(oldDir, newDir string) {
+	for wd, path := range iw.dirs {
+		if path == oldDir {
+			iw.dirs[wd] = newDir
+		} else if strings.HasPrefix(path, oldDir+string(filepath.Separator)) {
+			iw.dirs[wd] = newDir + path[len(oldDir):]
+		}
+	}
+}
+
+// isShardPath checks whether the path is a shard dir which should not be noticed.
+func (iw *inotifyWatcher) isShardPath(path string) bool {
+	return iw.s.layout == LayoutSharded && isShardPath(path)
+}
+
+func (iw *inotifyWatcher) loop() error {
+	buf := make([]byte, 64*1024)
+
+	for {
+		// Wake up to flush moves which are not matched in time.
+		var deadline time.Time
+		for _, mv := range iw.moves {
+			if at := mv.at.Add(inotifyMoveTimeout); deadline.IsZero() || at.Before(deadline) {
+				deadline = at
+			}
+		}
+		n, err := 0, iw.f.SetReadDeadline(deadline)
+		if err == nil {
+			n, err = iw.f.Read(buf)
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if !iw.flushMoves(time.Now()) {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			select {
+			case <-iw.w.done:
+				// The file has been closed by Close.
+				return nil
+			default:
+				return err
+			}
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent
+
+			var name string
+			if raw.Len > 0 {
+				name = strings.TrimRight(string(buf[off:off+int(raw.Len)]), "\x00")
+				off += int(raw.Len)
+			}
+
+			if !iw.handle(int(raw.Wd), raw.Mask, raw.Cookie, name) {
+				return nil
+			}
+		}
+
+		if !iw.flushMoves(time.Now()) {
+			return nil
+		}
+	}
+}
+
+// flushMoves reports moves which have not been matched before timeout, they have
+// been moved outside of the watched tree.
+func (iw *inotifyWatcher) flushMoves(now time.Time) bool {
+	for cookie, mv := range iw.moves {
+		if now.Sub(mv.at) < inotifyMoveTimeout {
+			continue
+		}
+		delete(iw.moves, cookie)
+		if mv.isDir {
+			iw.removeWatchTree(mv.path)
+		}
+		if !iw.w.emit(WatchEvent{Op: WatchMove, OldPath: iw.s.relPath(mv.path), IsDir: mv.isDir}) {
+			return false
+		}
+	}
+	return true
+}
+
+// handle converts an inotify event into watch events, returns false if the watcher should stop.
+func (iw *inotifyWatcher) handle(wd int, mask, cookie uint32, name string) bool {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events have been dropped by kernel, pending moves are not reliable anymore.
+		iw.moves = make(map[uint32]inotifyMove)
+		return iw.w.emit(WatchEvent{Op: WatchRescan, Path: iw.s.relPath(iw.root), IsDir: true})
+	}
+
+	dir, ok := iw.dirs[wd]
+	if !ok {
+		// Events for removed watches could still be queued.
+		return true
+	}
+
+	if mask&unix.IN_IGNORED != 0 {
+		delete(iw.dirs, wd)
+		// Stop watching after the root has been removed.
+		return dir != iw.root
+	}
+	if mask&unix.IN_DELETE_SELF != 0 {
+		if dir == iw.root {
+			return iw.w.emit(WatchEvent{Op: WatchDelete, Path: iw.s.relPath(dir), IsDir: true})
+		}
+		// Deletion of sub dirs will be reported by their parents.
+		return true
+	}
+
+	abs := filepath.Join(dir, name)
+	// Changes in internal dirs should not be noticed.
+	if iw.s.isHiddenPath(abs) {
+		return true
+	}
+	isDir := mask&unix.IN_ISDIR != 0
+	ev := WatchEvent{Path: iw.s.relPath(abs), IsDir: isDir}
+
+	// Shard dirs are watched for their objects, but changes of themselves are not noticed.
+	if iw.isShardPath(abs) {
+		if isDir && mask&unix.IN_CREATE != 0 {
+			return iw.addWatchTree(abs)
+		}
+		return true
+	}
+
+	switch {
+	case mask&unix.IN_CREATE != 0:
+		ev.Op = WatchCreate
+		if !iw.w.emit(ev) {
+			return false
+		}
+		if isDir && iw.recursive {
+			return iw.addWatchTree(abs)
+		}
+		return true
+	case mask&unix.IN_CLOSE_WRITE != 0:
+		ev.Op = WatchWrite
+	case mask&unix.IN_DELETE != 0:
+		ev.Op = WatchDelete
+	case mask&unix.IN_MOVED_FROM != 0:
+		iw.moves[cookie] = inotifyMove{path: abs, isDir: isDir, at: time.Now()}
+		return true
+	case mask&unix.IN_MOVED_TO != 0:
+		ev.Op = WatchMove
+		mv, ok := iw.moves[cookie]
+		if ok {
+			delete(iw.moves, cookie)
+			ev.OldPath = iw.s.relPath(mv.path)
+			if isDir && iw.recursive {
+				iw.renameWatchTree(mv.path, abs)
+			}
+		}
+		if !iw.w.emit(ev) {
+			return false
+		}
+		// Dir moved in from outside should be watched too.
+		if !ok && isDir && iw.recursive {
+			return iw.addWatchTree(abs)
+		}
+		return true
+	default:
+		return true
+	}
+	return iw.w.emit(ev)
+}
@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.Watch("", WithWatchRecursive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	_, err = s.CreateDir("dir")
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchCreate, Path: "dir", IsDir: true})
+
+	content := []byte("hello")
+	_, err = s.Write("dir/a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchWrite, Path: "dir/a"})
+
+	err = s.Move("dir/a", "dir/b")
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchMove, Path: "dir/b", OldPath: "dir/a"})
+
+	_, err = s.CreateDir("dir/sub")
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchCreate, Path: "dir/sub", IsDir: true})
+
+	_, err = s.Write("dir/sub/c", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchWrite, Path: "dir/sub/c"})
+
+	err = s.Delete("dir/b")
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchDelete, Path: "dir/b"})
+}
+
+func TestInotifyWatcherOverflow(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overflow can't be provoked reliably, so we feed the event directly.
+	iw := &inotifyWatcher{s: s, w: newWatcher(), root: s.workDir}
+	go iw.handle(-1, unix.IN_Q_OVERFLOW, 0, "")
+
+	ev := <-iw.w.Events()
+	assert.Equal(t, WatchEvent{Op: WatchRescan, Path: "", IsDir: true}, ev)
+}
+
+func TestInotifyWatcherSplitMove(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Split reads can't be provoked reliably, so we feed the events directly.
+	iw := &inotifyWatcher{
+		s:     s,
+		w:     newWatcher(),
+		root:  s.workDir,
+		dirs:  map[int]string{1: s.workDir},
+		moves: make(map[uint32]inotifyMove),
+	}
+
+	// IN_MOVED_TO could be read in the next batch.
+	assert.True(t, iw.handle(1, unix.IN_MOVED_FROM, 1, "a"))
+	assert.True(t, iw.flushMoves(time.Now()))
+	assert.True(t, iw.handle(1, unix.IN_MOVED_TO, 1, "b"))
+	assert.Equal(t, WatchEvent{Op: WatchMove, Path: "b", OldPath: "a"}, <-iw.w.Events())
+
+	// Moves without IN_MOVED_TO are flushed after timeout.
+	assert.True(t, iw.handle(1, unix.IN_MOVED_FROM, 2, "c"))
+	assert.True(t, iw.flushMoves(time.Now().Add(inotifyMoveTimeout)))
+	assert.Equal(t, WatchEvent{Op: WatchMove, OldPath: "c"}, <-iw.w.Events())
+	assert.Empty(t, iw.moves)
+}
+
+func TestInotifyWatcherSharded(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()), WithLayout(LayoutSharded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.Watch("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Shard dirs could be created before watched, create event will be emitted anyway.
+	content := []byte("hello")
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchCreate, Path: "a"})
+
+	_, err = s.Write("a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchWrite, Path: "a"})
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"context"
+)
+
+func (s *Storage) newNotifyWatcher(ctx context.Context, rp string, opt pairStorageWatch) (w *Watcher, err error) {
+	return nil, errNotifyUnsupported
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+// waitWatchEvent waits until the expected event has been received.
+func waitWatchEvent(t *testing.T, w *Watcher, expected WatchEvent) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("watcher closed before %+v received: %v", expected, w.Err())
+			}
+			if ev == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("event %+v not received", expected)
+		}
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateDir("dir")
+	assert.NoError(t, err)
+
+	w, err := s.newPollWatcher(context.Background(), s.getAbsPath(""), pairStorageWatch{
+		HasWatchInterval:  true,
+		WatchInterval:     10 * time.Millisecond,
+		HasWatchRecursive: true,
+		WatchRecursive:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	content := []byte("hello")
+	_, err = s.Write("dir/a", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchCreate, Path: "dir/a"})
+
+	_, err = s.Write("dir/a", bytes.NewReader(content), 1)
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchWrite, Path: "dir/a"})
+
+	err = s.Delete("dir/a")
+	assert.NoError(t, err)
+	waitWatchEvent(t, w, WatchEvent{Op: WatchDelete, Path: "dir/a"})
+}
+
+func TestWatchClosedByContext(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := s.WatchWithContext(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-w.Events():
+		for ok {
+			_, ok = <-w.Events()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher not closed after context canceled")
+	}
+	assert.NoError(t, w.Err())
+}
+
+func TestDiffPollSnapshot(t *testing.T) {
+	now := time.Now()
+	prev := map[string]pollEntry{
+		"a":   {size: 1, modTime: now},
+		"b":   {size: 1, modTime: now},
+		"dir": {isDir: true},
+	}
+	cur := map[string]pollEntry{
+		"a":   {size: 2, modTime: now},
+		"c":   {size: 1, modTime: now},
+		"dir": {isDir: true},
+	}
+
+	assert.Equal(t, []WatchEvent{
+		{Op: WatchWrite, Path: "a"},
+		{Op: WatchDelete, Path: "b"},
+		{Op: WatchCreate, Path: "c"},
+	}, diffPollSnapshot(prev, cur))
+}
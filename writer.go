@@ -0,0 +1,261 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/pkg/iowrap"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+// tmpDir is the hidden dir under work dir to store temporary files of pending writes,
+// it's only used while hidden_temp_files is set.
+//
+// Temporary files are renamed to objects after written, so the file system under
+// work dir must not be split by mount points.
+const (
+	tmpDir = ".tmp"
+
+	// tmpRetention is the duration temporary files will be kept before swept.
+	tmpRetention = 24 * time.Hour
+)
+
+// errWriterAborted is used to stop the pending write while Writer is aborted.
+var errWriterAborted = errors.New("writer aborted")
+
+// Writer is a streaming writer for content whose size is unknown before written.
+//
+// Content is written into a temporary file next to the object (or under the hidden tmp
+// dir while hidden_temp_files is set), and published by rename while Writer is closed,
+// so readers will never see a partial object.
+// In cas mode, content is published by linking to the blob instead.
+type Writer struct {
+	// n must be the first field to keep 64-bit alignment for atomic operations.
+	n int64
+
+	s    *Storage
+	ctx  context.Context
+	path string
+
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+
+	closeOnce sync.Once
+}
+
+// NewWriter will create a streaming writer for the object.
+//
+// The object will be published while the writer is closed, the writer must be
+// closed or aborted after used.
+func (s *Storage) NewWriter(path string, pairs ...Pair) (w *Writer, err error) {
+	ctx := context.Background()
+	return s.NewWriterWithContext(ctx, path, pairs...)
+}
+
+// NewWriterWithContext will create a streaming writer for the object.
+//
+// The pending write will be aborted while the context is done before the writer is closed.
+func (s *Storage) NewWriterWithContext(ctx context.Context, path string, pairs ...Pair) (w *Writer, err error) {
+	defer func() {
+		err = s.formatError("new_writer", err, path)
+	}()
+
+	pairs = append(pairs, s.defaultPairs.Write...)
+	opt, err := s.parsePairStorageWrite(pairs)
+	if err != nil {
+		return
+	}
+	return s.newWriter(ctx, strings.ReplaceAll(path, "\\", "/"), opt)
+}
+
+func (s *Storage) newWriter(ctx context.Context, path string, opt pairStorageWrite) (w *Writer, err error) {
+	rp := s.getAbsPath(path)
+
+	// Check the target before accepting any content.
+	stream := s.isStreamPath(rp, os.O_WRONLY)
+	if !stream {
+		err = s.checkWriteTarget(rp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	w = &Writer{
+		s:    s,
+		ctx:  ctx,
+		path: path,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.done)
+
+		// Blobs are published by linking, and streams are written directly.
+		if s.cas || stream {
+			_, w.err = s.write(ctx, path, pr, -1, opt)
+		} else {
+			var r io.Reader = pr
+			if opt.HasIoCallback {
+				r = iowrap.CallbackReader(r, opt.IoCallback)
+			}
+			_, w.err = s.writeTemp(rp, r, -1, opt)
+		}
+		// Unblock the pending Write if we failed before EOF.
+		if w.err != nil {
+			_ = pr.CloseWithError(w.err)
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = pw.CloseWithError(ctx.Err())
+		case <-w.done:
+		}
+	}()
+	return w, nil
+}
+
+// writeTemp writes all content into a temporary file, and renames it to the object.
+//
+// The object will be kept as is if the write failed.
+func (s *Storage) writeTemp(rp string, r io.Reader, size int64, opt pairStorageWrite) (n int64, err error) {
+	f, err := s.createTempFile(rp)
+	if err != nil {
+		return
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	n, h, err := s.writeFile(f, tmp, r, size, opt)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	err = s.replaceFile(tmp, rp)
+	if err != nil {
+		return n, err
+	}
+
+	if h != nil {
+		return n, s.saveChecksum(rp, h)
+	}
+	return n, nil
+}
+
+// createTempFile creates a hidden temporary file, so that it could be renamed to rp atomically.
+//
+// The file is created in the hidden tmp dir while hidden_temp_files is set, otherwise
+// it's created in the same dir of rp.
+func (s *Storage) createTempFile(rp string) (f *os.File, err error) {
+	dir, name := filepath.Split(rp)
+	prefix := "."
+	if s.hiddenTempFiles {
+		dir, prefix = filepath.Join(s.workDir, tmpDir), ""
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	for {
+		tmp := filepath.Join(dir, fmt.Sprintf("%s%s.%s.tmp", prefix, name, formatTimeID(now)))
+
+		f, err = os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0664)
+		if errors.Is(err, os.ErrExist) {
+			now = now.Add(time.Nanosecond)
+			continue
+		}
+		return f, err
+	}
+}
+
+// sweepTempFiles removes temporary files left by crashed writes in the hidden tmp dir.
+//
+// Temporary files could be used by pending writes, so only stale ones will be removed.
+func (s *Storage) sweepTempFiles() (err error) {
+	dir := filepath.Join(s.workDir, tmpDir)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || time.Since(fi.ModTime()) <= tmpRetention {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, fi.Name()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	n, err = w.pw.Write(p)
+	atomic.AddInt64(&w.n, int64(n))
+	if err != nil {
+		return n, w.s.formatError("write", err, w.path)
+	}
+	return n, nil
+}
+
+// Written returns the count of bytes which have been written.
+func (w *Writer) Written() int64 {
+	return atomic.LoadInt64(&w.n)
+}
+
+// Close implements io.Closer, the object will be published after Close returned without error.
+func (w *Writer) Close() (err error) {
+	w.closeOnce.Do(func() {
+		// The context could be done before noticed by the watching goroutine.
+		_ = w.pw.CloseWithError(w.ctx.Err())
+	})
+	<-w.done
+
+	if w.err != nil {
+		return w.s.formatError("close", w.err, w.path)
+	}
+	return nil
+}
+
+// Abort discards all written content, the object will not be modified.
+func (w *Writer) Abort() (err error) {
+	w.closeOnce.Do(func() {
+		_ = w.pw.CloseWithError(errWriterAborted)
+	})
+	<-w.done
+
+	// The pending write could have been failed for other reasons.
+	if w.err != nil && !errors.Is(w.err, errWriterAborted) {
+		return w.s.formatError("abort", w.err, w.path)
+	}
+	return nil
+}
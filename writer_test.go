@@ -0,0 +1,228 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	. "github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestWriter(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+	}{
+		{"plain", nil},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}},
+		{"encrypted", []Pair{WithEncryptionKey(testKeyA)}},
+		{"cas", []Pair{WithCas()}},
+		{"checksum", []Pair{WithChecksumAlgorithm(ChecksumSHA256)}},
+		{"hidden temp files", []Pair{WithHiddenTempFiles()}},
+	}
+
+	content := make([]byte, 2*compressionFrameSize+100)
+	rand.Read(content)
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			s, err := newStorager(append([]Pair{ps.WithWorkDir(tmp)}, tt.pairs...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := s.NewWriter("a/b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for off := 0; off < len(content); off += 4096 {
+				end := off + 4096
+				if end > len(content) {
+					end = len(content)
+				}
+				_, err = w.Write(content[off:end])
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, int64(len(content)), w.Written())
+
+			// Object should not be visible before closed.
+			_, err = s.Stat("a/b")
+			assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+			// Neither the temporary file.
+			it, err := s.List("")
+			assert.NoError(t, err)
+			for {
+				o, err := it.Next()
+				if errors.Is(err, IterateDone) {
+					break
+				}
+				assert.NoError(t, err)
+				assert.NotEqual(t, tmpDir, o.Path)
+			}
+
+			assert.NoError(t, w.Close())
+
+			var buf bytes.Buffer
+			_, err = s.Read("a/b", &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, content, buf.Bytes())
+
+			// Temporary files should be cleaned.
+			fis, err := ioutil.ReadDir(s.getAbsPath("a"))
+			assert.NoError(t, err)
+			assert.Len(t, fis, 1)
+			fis, err = ioutil.ReadDir(filepath.Join(tmp, tmpDir))
+			if err == nil {
+				assert.Len(t, fis, 0)
+			}
+		})
+	}
+}
+
+func TestWriterAbort(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write("a", bytes.NewReader([]byte("old")), 3)
+	assert.NoError(t, err)
+
+	w, err := s.NewWriter("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("new content"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Abort())
+
+	var buf bytes.Buffer
+	_, err = s.Read("a", &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", buf.String())
+
+	fis, err := ioutil.ReadDir(s.workDir)
+	assert.NoError(t, err)
+	assert.Len(t, fis, 1)
+}
+
+func TestWriterCancel(t *testing.T) {
+	s, err := newStorager(ps.WithWorkDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := s.NewWriterWithContext(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("content"))
+	assert.NoError(t, err)
+
+	cancel()
+	err = w.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	_, err = w.Write([]byte("content"))
+	assert.Error(t, err)
+
+	_, err = s.Stat("a")
+	assert.True(t, errors.Is(err, services.ErrObjectNotExist))
+	fis, err := ioutil.ReadDir(s.workDir)
+	assert.NoError(t, err)
+	assert.Len(t, fis, 0)
+}
+
+func TestWriterSweep(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, tmpDir), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale := filepath.Join(dir, tmpDir, "a.stale.tmp")
+	fresh := filepath.Join(dir, tmpDir, "a.fresh.tmp")
+	for _, p := range []string{stale, fresh} {
+		err = ioutil.WriteFile(p, []byte("content"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Now().Add(-2 * tmpRetention)
+	err = os.Chtimes(stale, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without hidden_temp_files, tmp dir is a normal dir which must be kept.
+	s, err := newStorager(ps.WithWorkDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(stale)
+	assert.NoError(t, err)
+	_, err = s.Stat(tmpDir + "/a.stale.tmp")
+	assert.NoError(t, err)
+
+	// Temporary files left by crashed writes should be swept while starting.
+	_, err = newStorager(ps.WithWorkDir(dir), WithHiddenTempFiles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(stale)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = os.Stat(fresh)
+	assert.NoError(t, err)
+}
+
+func TestWriteUnknownSize(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []Pair
+		size  int
+	}{
+		{"plain", nil, 1000},
+		{"empty", nil, 0},
+		{"compressed", []Pair{WithCompression(CompressionGzip)}, 2*compressionFrameSize + 100},
+		{"compressed aligned", []Pair{WithCompression(CompressionGzip)}, compressionFrameSize},
+		{"compressed empty", []Pair{WithCompression(CompressionGzip)}, 0},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStorager(append([]Pair{ps.WithWorkDir(t.TempDir())}, tt.pairs...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content := make([]byte, tt.size)
+			rand.Read(content)
+
+			// Hide the size of bytes.Reader.
+			n, err := s.Write("a", io.MultiReader(bytes.NewReader(content)), -1)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(tt.size), n)
+
+			o, err := s.Stat("a")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(tt.size), o.MustGetContentLength())
+
+			var buf bytes.Buffer
+			_, err = s.Read("a", &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, content, buf.Bytes())
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package fs
+
+import (
+	"errors"
+)
+
+// xattrPrefix is the namespace of all extended attributes set by us.
+const xattrPrefix = "user.beyondstorage."
+
+var (
+	// errXattrNotExist means the extended attribute is not set on this file.
+	errXattrNotExist = errors.New("xattr not exist")
+	// errXattrUnsupported means the platform or file system doesn't support extended attributes.
+	errXattrUnsupported = errors.New("xattr unsupported")
+)
@@ -0,0 +1,8 @@
+package fs
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// errnoNoAttr is returned while the extended attribute is not set.
+const errnoNoAttr = unix.ENODATA
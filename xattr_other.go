@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fs
+
+// getXattr is not supported on this platform.
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+// setXattr is not supported on this platform.
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+// removeXattr is not supported on this platform.
+func removeXattr(path, name string) error {
+	return errXattrUnsupported
+}
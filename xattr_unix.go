@@ -0,0 +1,65 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// getXattr returns the value of the extended attribute.
+func getXattr(path, name string) ([]byte, error) {
+	buf := make([]byte, 128)
+	for {
+		n, err := unix.Getxattr(path, xattrPrefix+name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// Buffer is too small, query the real size and retry.
+			n, err = unix.Getxattr(path, xattrPrefix+name, nil)
+			if err != nil {
+				return nil, formatXattrError("getxattr", err)
+			}
+			buf = make([]byte, n)
+			continue
+		}
+		if err != nil {
+			return nil, formatXattrError("getxattr", err)
+		}
+		return buf[:n], nil
+	}
+}
+
+// setXattr sets the value of the extended attribute.
+func setXattr(path, name string, value []byte) error {
+	err := unix.Setxattr(path, xattrPrefix+name, value, 0)
+	if err != nil {
+		return formatXattrError("setxattr", err)
+	}
+	return nil
+}
+
+// removeXattr removes the extended attribute, it's ok if the attribute is not set.
+func removeXattr(path, name string) error {
+	err := unix.Removexattr(path, xattrPrefix+name)
+	if err != nil {
+		err = formatXattrError("removexattr", err)
+		if errors.Is(err, errXattrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func formatXattrError(op string, err error) error {
+	switch {
+	case errors.Is(err, errnoNoAttr):
+		return errXattrNotExist
+	case errors.Is(err, unix.ENOTSUP), errors.Is(err, unix.EOPNOTSUPP):
+		return errXattrUnsupported
+	default:
+		return os.NewSyscallError(op, err)
+	}
+}